@@ -0,0 +1,976 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	_ "github.com/mfinancecombr/finance-wallet-api/config"
+	"github.com/mfinancecombr/finance-wallet-api/db"
+	"github.com/mfinancecombr/finance-wallet-api/financeapi"
+	"github.com/mfinancecombr/finance-wallet-api/tracing"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type testServer struct {
+	t      *testing.T
+	server Server
+	stub   *financeapi.Stub
+}
+
+// openTestDB opens the database of each test server, in memory unless
+// TestSQLite runs the suite against SQLite.
+var openTestDB = func(t *testing.T) db.DB {
+	return db.NewMemorySession()
+}
+
+func newTestServer(t *testing.T) *testServer {
+	stub := &financeapi.Stub{
+		Quotes: map[string]map[string]map[string]interface{}{
+			"stocks": {"PETR4": {"lastPrice": 25, "name": "Petrobras"}},
+		},
+	}
+	previous := financeapi.DefaultQuotes
+	financeapi.DefaultQuotes = financeapi.NewQuoteClient(stub, financeapi.QuoteOptions{})
+	t.Cleanup(func() { financeapi.DefaultQuotes = previous })
+	return &testServer{t: t, server: NewServer(openTestDB(t)), stub: stub}
+}
+
+// do sends a request and decodes the JSON response into result, when given.
+func (ts *testServer) do(method, path string, body interface{}, result interface{}) int {
+	ts.t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Actor", "tester")
+	rec := httptest.NewRecorder()
+	ts.server.ServeHTTP(rec, req)
+	if result != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+			ts.t.Fatalf("%s %s: invalid response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func (ts *testServer) expect(status int, method, path string, body interface{}, result interface{}) {
+	ts.t.Helper()
+	if code := ts.do(method, path, body, result); code != status {
+		ts.t.Fatalf("%s %s: expected status %d, got %d", method, path, status, code)
+	}
+}
+
+// create inserts a document and returns its id.
+func (ts *testServer) create(path string, body interface{}) string {
+	ts.t.Helper()
+	result := map[string]interface{}{}
+	ts.expect(http.StatusOK, http.MethodPost, path, body, &result)
+	id, _ := result["InsertedID"].(string)
+	if id == "" {
+		ts.t.Fatalf("POST %s: missing inserted id in %v", path, result)
+	}
+	return id
+}
+
+func (ts *testServer) seed() (brokerID, portfolioID string) {
+	brokerID = ts.create("/api/v1/brokers", map[string]interface{}{"name": "Broker"})
+	portfolioID = ts.create("/api/v1/portfolios", map[string]interface{}{"name": "Default"})
+	return brokerID, portfolioID
+}
+
+func operation(symbol string) map[string]interface{} {
+	return map[string]interface{}{
+		"brokerSlug":        "broker",
+		"commission":        1,
+		"date":              "2020-01-02T00:00:00Z",
+		"dueDate":           "2025-01-02T00:00:00Z",
+		"fixedInterestRate": 10.5,
+		"portfolioSlug":     "default",
+		"price":             20,
+		"shares":            10,
+		"symbol":            symbol,
+		"type":              "purchase",
+	}
+}
+
+func TestBrokersCRUD(t *testing.T) {
+	ts := newTestServer(t)
+	id := ts.create("/api/v1/brokers", map[string]interface{}{"name": "Broker"})
+
+	ts.expect(http.StatusConflict, http.MethodPost, "/api/v1/brokers",
+		map[string]interface{}{"name": "Broker"}, nil)
+	ts.expect(http.StatusUnprocessableEntity, http.MethodPost, "/api/v1/brokers",
+		map[string]interface{}{"CNPJ": "00.000.000/0001-00"}, nil)
+
+	broker := map[string]interface{}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/brokers/broker", nil, &broker)
+	if broker["id"] != id || broker["name"] != "Broker" {
+		t.Fatalf("unexpected broker %v", broker)
+	}
+
+	ts.expect(http.StatusOK, http.MethodPut, "/api/v1/brokers/"+id,
+		map[string]interface{}{"name": "Renamed", "slug": "broker"}, nil)
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/brokers/broker", nil, &broker)
+	if broker["name"] != "Renamed" {
+		t.Fatalf("broker not updated: %v", broker)
+	}
+
+	brokers := []interface{}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/brokers", nil, &brokers)
+	if len(brokers) != 1 {
+		t.Fatalf("expected 1 broker, got %d", len(brokers))
+	}
+
+	ts.expect(http.StatusOK, http.MethodDelete, "/api/v1/brokers/"+id, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/v1/brokers/broker", nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodDelete, "/api/v1/brokers/"+id, nil, nil)
+}
+
+func TestPortfoliosCRUD(t *testing.T) {
+	ts := newTestServer(t)
+	id := ts.create("/api/v1/portfolios", map[string]interface{}{"name": "Default"})
+
+	portfolio := map[string]interface{}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/portfolios/default", nil, &portfolio)
+	if portfolio["id"] != id {
+		t.Fatalf("unexpected portfolio %v", portfolio)
+	}
+
+	ts.expect(http.StatusOK, http.MethodPut, "/api/v1/portfolios/"+id,
+		map[string]interface{}{"name": "Main", "slug": "default"}, nil)
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/portfolios/default", nil, &portfolio)
+	if portfolio["name"] != "Main" {
+		t.Fatalf("portfolio not updated: %v", portfolio)
+	}
+
+	ts.expect(http.StatusOK, http.MethodDelete, "/api/v1/portfolios/"+id, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/v1/portfolios/default", nil, nil)
+}
+
+func TestOperations(t *testing.T) {
+	for _, itemType := range []string{
+		"stocks", "fiis", "treasuries-direct", "certificates-of-deposit", "stocks-funds", "ficfi",
+	} {
+		t.Run(itemType, func(t *testing.T) {
+			ts := newTestServer(t)
+			ts.seed()
+			path := fmt.Sprintf("/api/v1/%s/operations", itemType)
+
+			invalid := operation("ABC")
+			delete(invalid, "price")
+			ts.expect(http.StatusUnprocessableEntity, http.MethodPost, path, invalid, nil)
+
+			id := ts.create(path, operation("ABC"))
+
+			result := map[string]interface{}{}
+			ts.expect(http.StatusOK, http.MethodGet, path+"/"+id, nil, &result)
+			if result["symbol"] != "ABC" || result["price"] != 20.0 {
+				t.Fatalf("unexpected operation %v", result)
+			}
+
+			updated := operation("ABC")
+			updated["price"] = 21.37
+			ts.expect(http.StatusOK, http.MethodPut, path+"/"+id, updated, nil)
+			ts.expect(http.StatusOK, http.MethodGet, path+"/"+id, nil, &result)
+			if result["price"] != 21.37 {
+				t.Fatalf("operation not updated: %v", result)
+			}
+
+			history := []map[string]interface{}{}
+			ts.expect(http.StatusOK, http.MethodGet, "/api/v1/operations/"+id+"/history", nil, &history)
+			if len(history) != 2 || history[0]["action"] != "update" || history[0]["actor"] != "tester" {
+				t.Fatalf("unexpected history %v", history)
+			}
+		})
+	}
+}
+
+func TestOperationReferences(t *testing.T) {
+	ts := newTestServer(t)
+	ts.seed()
+
+	missing := operation("PETR4")
+	missing["brokerSlug"] = "unknown"
+	ts.expect(http.StatusUnprocessableEntity, http.MethodPost, "/api/v1/stocks/operations", missing, nil)
+
+	missing = operation("PETR4")
+	missing["portfolioSlug"] = "unknown"
+	ts.expect(http.StatusUnprocessableEntity, http.MethodPost, "/api/v1/stocks/operations", missing, nil)
+}
+
+func countOperations(ts *testServer) int {
+	operations := []interface{}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/operations", nil, &operations)
+	return len(operations)
+}
+
+func TestDeleteReferencedBroker(t *testing.T) {
+	ts := newTestServer(t)
+	brokerID, _ := ts.seed()
+	ts.create("/api/v1/stocks/operations", operation("PETR4"))
+
+	ts.expect(http.StatusConflict, http.MethodDelete, "/api/v1/brokers/"+brokerID, nil, nil)
+	ts.expect(http.StatusUnprocessableEntity, http.MethodDelete,
+		"/api/v1/brokers/"+brokerID+"?onDelete=reassign&reassignTo=unknown", nil, nil)
+
+	ts.create("/api/v1/brokers", map[string]interface{}{"name": "Other"})
+	ts.expect(http.StatusOK, http.MethodDelete,
+		"/api/v1/brokers/"+brokerID+"?onDelete=reassign&reassignTo=other", nil, nil)
+
+	operations := []map[string]interface{}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/operations", nil, &operations)
+	if len(operations) != 1 || operations[0]["brokerSlug"] != "other" {
+		t.Fatalf("operations not reassigned: %v", operations)
+	}
+}
+
+func TestDeleteReferencedPortfolio(t *testing.T) {
+	ts := newTestServer(t)
+	_, portfolioID := ts.seed()
+	ts.create("/api/v1/stocks/operations", operation("PETR4"))
+
+	ts.expect(http.StatusConflict, http.MethodDelete, "/api/v1/portfolios/"+portfolioID, nil, nil)
+	ts.expect(http.StatusOK, http.MethodDelete, "/api/v1/portfolios/"+portfolioID+"?onDelete=cascade", nil, nil)
+	if n := countOperations(ts); n != 0 {
+		t.Fatalf("expected operations to be deleted, got %d", n)
+	}
+}
+
+func TestReassignToAlias(t *testing.T) {
+	ts := newTestServer(t)
+	_, portfolioID := ts.seed()
+	otherID := ts.create("/api/v1/portfolios", map[string]interface{}{"name": "Other"})
+	ts.create("/api/v1/stocks/operations", operation("PETR4"))
+	ts.expect(http.StatusOK, http.MethodPut, "/api/v1/portfolios/"+portfolioID,
+		map[string]interface{}{"name": "Default", "slug": "renamed"}, nil)
+	ts.expect(http.StatusOK, http.MethodPut, "/api/v1/portfolios/"+otherID,
+		map[string]interface{}{"name": "Other", "slug": "current"}, nil)
+
+	// "default" is an alias of the portfolio being deleted.
+	ts.expect(http.StatusUnprocessableEntity, http.MethodDelete,
+		"/api/v1/portfolios/"+portfolioID+"?onDelete=reassign&reassignTo=default", nil, nil)
+	ts.expect(http.StatusOK, http.MethodDelete,
+		"/api/v1/portfolios/"+portfolioID+"?onDelete=reassign&reassignTo=other", nil, nil)
+
+	operations := []map[string]interface{}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/operations", nil, &operations)
+	if len(operations) != 1 || operations[0]["portfolioSlug"] != "current" {
+		t.Fatalf("expected operations reassigned to the current slug, got %v", operations)
+	}
+}
+
+func TestRenameBroker(t *testing.T) {
+	ts := newTestServer(t)
+	brokerID, _ := ts.seed()
+	ts.create("/api/v1/brokers", map[string]interface{}{"name": "Other"})
+	ts.create("/api/v1/stocks/operations", operation("PETR4"))
+
+	ts.expect(http.StatusConflict, http.MethodPut, "/api/v1/brokers/"+brokerID,
+		map[string]interface{}{"name": "Broker", "slug": "other"}, nil)
+	ts.expect(http.StatusOK, http.MethodPut, "/api/v1/brokers/"+brokerID,
+		map[string]interface{}{"name": "Broker", "slug": "renamed"}, nil)
+
+	broker := map[string]interface{}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/brokers/broker", nil, &broker)
+	if broker["slug"] != "renamed" {
+		t.Fatalf("old slug should resolve to the renamed broker: %v", broker)
+	}
+
+	operations := []map[string]interface{}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/operations", nil, &operations)
+	if operations[0]["brokerSlug"] != "renamed" {
+		t.Fatalf("operations not renamed: %v", operations)
+	}
+}
+
+func TestOperationWithOldSlug(t *testing.T) {
+	ts := newTestServer(t)
+	_, portfolioID := ts.seed()
+	ts.expect(http.StatusOK, http.MethodPut, "/api/v1/portfolios/"+portfolioID,
+		map[string]interface{}{"name": "Default", "slug": "renamed"}, nil)
+
+	operationID := ts.create("/api/v1/stocks/operations", operation("PETR4"))
+	stock := map[string]interface{}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/stocks/operations/"+operationID, nil, &stock)
+	if stock["portfolioSlug"] != "renamed" {
+		t.Fatalf("expected the current slug to be saved, got %v", stock)
+	}
+	ts.expect(http.StatusConflict, http.MethodDelete, "/api/v1/portfolios/"+portfolioID, nil, nil)
+}
+
+func TestRestoreWithOldSlug(t *testing.T) {
+	ts := newTestServer(t)
+	brokerID, _ := ts.seed()
+	operationID := ts.create("/api/v1/stocks/operations", operation("PETR4"))
+	ts.expect(http.StatusOK, http.MethodDelete, "/api/v1/operations/"+operationID, nil, nil)
+	ts.expect(http.StatusOK, http.MethodPut, "/api/v1/brokers/"+brokerID,
+		map[string]interface{}{"name": "Broker", "slug": "renamed"}, nil)
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/v1/trash/operations/"+operationID+"/restore", nil, nil)
+	stock := map[string]interface{}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/stocks/operations/"+operationID, nil, &stock)
+	if stock["brokerSlug"] != "renamed" {
+		t.Fatalf("expected the restored operation to reference the current slug, got %v", stock)
+	}
+
+	// A broker taking the old slug while the renamed one is in the trash
+	// keeps it from being restored.
+	ts.expect(http.StatusOK, http.MethodDelete, "/api/v1/brokers/"+brokerID+"?onDelete=cascade", nil, nil)
+	ts.create("/api/v1/brokers", map[string]interface{}{"name": "Broker"})
+	ts.expect(http.StatusConflict, http.MethodPost, "/api/v1/trash/brokers/"+brokerID+"/restore", nil, nil)
+}
+
+func TestTrash(t *testing.T) {
+	ts := newTestServer(t)
+	brokerID, _ := ts.seed()
+	operationID := ts.create("/api/v1/stocks/operations", operation("PETR4"))
+
+	ts.expect(http.StatusOK, http.MethodDelete, "/api/v1/brokers/"+brokerID+"?onDelete=cascade", nil, nil)
+
+	trash := map[string][]map[string]interface{}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/trash", nil, &trash)
+	if len(trash["brokers"]) != 1 || len(trash["operations"]) != 1 {
+		t.Fatalf("unexpected trash %v", trash)
+	}
+	if deleted := trash["operations"][0]; deleted["price"] != 20.0 || deleted["deletedAt"] == nil {
+		t.Fatalf("expected a typed operation, got %v", deleted)
+	}
+
+	restore := "/api/v1/trash/operations/" + operationID + "/restore"
+	ts.expect(http.StatusUnprocessableEntity, http.MethodPost, restore, nil, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/v1/trash/brokers/"+brokerID+"/restore", nil, nil)
+	ts.expect(http.StatusOK, http.MethodPost, restore, nil, nil)
+	if n := countOperations(ts); n != 1 {
+		t.Fatalf("expected restored operation, got %d", n)
+	}
+	ts.expect(http.StatusUnprocessableEntity, http.MethodPost, "/api/v1/trash/unknown/"+brokerID+"/restore", nil, nil)
+
+	history := []map[string]interface{}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/history?collection=brokers", nil, &history)
+	if len(history) != 3 || history[0]["action"] != "restore" {
+		t.Fatalf("unexpected broker history %v", history)
+	}
+}
+
+func TestReuseDeletedSlug(t *testing.T) {
+	ts := newTestServer(t)
+	brokerID, _ := ts.seed()
+	ts.expect(http.StatusOK, http.MethodDelete, "/api/v1/brokers/"+brokerID, nil, nil)
+	ts.create("/api/v1/brokers", map[string]interface{}{"name": "Broker"})
+	ts.expect(http.StatusConflict, http.MethodPost, "/api/v1/trash/brokers/"+brokerID+"/restore", nil, nil)
+}
+
+// TestSQLite runs the tests storing data against a SQLite database.
+func TestSQLite(t *testing.T) {
+	previous := openTestDB
+	openTestDB = func(t *testing.T) db.DB {
+		path := viper.GetString("sqlite.path")
+		viper.Set("sqlite.path", filepath.Join(t.TempDir(), "wallet.db"))
+		defer viper.Set("sqlite.path", path)
+		session, err := db.NewSQLiteSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { session.Close() })
+		return session
+	}
+	t.Cleanup(func() { openTestDB = previous })
+
+	tests := []struct {
+		name string
+		test func(*testing.T)
+	}{
+		{"BrokersCRUD", TestBrokersCRUD},
+		{"PortfoliosCRUD", TestPortfoliosCRUD},
+		{"Operations", TestOperations},
+		{"OperationReferences", TestOperationReferences},
+		{"DeleteReferencedBroker", TestDeleteReferencedBroker},
+		{"DeleteReferencedPortfolio", TestDeleteReferencedPortfolio},
+		{"ReassignToAlias", TestReassignToAlias},
+		{"RenameBroker", TestRenameBroker},
+		{"OperationWithOldSlug", TestOperationWithOldSlug},
+		{"RestoreWithOldSlug", TestRestoreWithOldSlug},
+		{"Trash", TestTrash},
+		{"ReuseDeletedSlug", TestReuseDeletedSlug},
+		{"PortfolioCalculation", TestPortfolioCalculation},
+		{"PortfoliosList", TestPortfoliosList},
+		{"MaterializedPositions", TestMaterializedPositions},
+		{"StaleQuotes", TestStaleQuotes},
+		{"Prices", TestPrices},
+		{"PortfolioAsOf", TestPortfolioAsOf},
+	}
+	for _, test := range tests {
+		t.Run(test.name, test.test)
+	}
+}
+
+func TestPortfolioCalculation(t *testing.T) {
+	ts := newTestServer(t)
+	ts.seed()
+	ts.create("/api/v1/stocks/operations", operation("PETR4"))
+
+	portfolio := struct {
+		CostBasis     json.Number                         `json:"costBasis"`
+		Gain          json.Number                         `json:"gain"`
+		OverallReturn json.Number                         `json:"overallReturn"`
+		Items         map[string][]map[string]interface{} `json:"items"`
+	}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/portfolios/default", nil, &portfolio)
+
+	if portfolio.CostBasis != "201.00" || portfolio.Gain != "49.00" || portfolio.OverallReturn != "24.38" {
+		t.Fatalf("unexpected totals: %+v", portfolio)
+	}
+	stocks := portfolio.Items["stocks"]
+	if len(stocks) != 1 || stocks[0]["name"] != "Petrobras" || stocks[0]["lastPrice"] != 25.0 {
+		t.Fatalf("unexpected positions %v", stocks)
+	}
+}
+
+func TestPortfoliosList(t *testing.T) {
+	ts := newTestServer(t)
+	ts.seed()
+	ts.create("/api/v1/portfolios", map[string]interface{}{"name": "Other"})
+	ts.create("/api/v1/stocks/operations", operation("PETR4"))
+	other := operation("VALE3")
+	other["portfolioSlug"] = "other"
+	ts.create("/api/v1/stocks/operations", other)
+	later := operation("ITSA4")
+	later["date"] = "2021-03-01T00:00:00Z"
+	ts.create("/api/v1/stocks/operations", later)
+
+	portfolios := []struct {
+		Slug  string                              `json:"slug"`
+		Items map[string][]map[string]interface{} `json:"items"`
+	}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/portfolios?year=2020", nil, &portfolios)
+	if len(portfolios) != 2 {
+		t.Fatalf("expected 2 portfolios, got %d", len(portfolios))
+	}
+	for _, p := range portfolios {
+		stocks := p.Items["stocks"]
+		expected := map[string]string{"default": "PETR4", "other": "VALE3"}[p.Slug]
+		if len(stocks) != 1 || stocks[0]["symbol"] != expected {
+			t.Fatalf("unexpected %s positions %v", p.Slug, stocks)
+		}
+	}
+}
+
+func TestMaterializedPositions(t *testing.T) {
+	ts := newTestServer(t)
+	_, portfolioID := ts.seed()
+	thisYear := fmt.Sprintf("%d-01-02T00:00:00Z", time.Now().Year())
+	purchase := operation("PETR4")
+	purchase["date"] = thisYear
+	id := ts.create("/api/v1/stocks/operations", purchase)
+
+	costBasis := func(slug string) string {
+		t.Helper()
+		portfolio := struct {
+			Items map[string][]map[string]json.RawMessage `json:"items"`
+		}{}
+		ts.expect(http.StatusOK, http.MethodGet, "/api/v1/portfolios/"+slug, nil, &portfolio)
+		stocks := portfolio.Items["stocks"]
+		if len(stocks) == 0 {
+			return ""
+		}
+		return string(stocks[0]["costBasis"])
+	}
+
+	if got := costBasis("default"); got != "201.00" {
+		t.Fatalf("expected cost basis 201.00, got %q", got)
+	}
+
+	purchase["price"] = 30
+	ts.expect(http.StatusOK, http.MethodPut, "/api/v1/stocks/operations/"+id, purchase, nil)
+	if got := costBasis("default"); got != "301.00" {
+		t.Fatalf("expected cost basis 301.00 after update, got %q", got)
+	}
+
+	ts.expect(http.StatusOK, http.MethodPut, "/api/v1/portfolios/"+portfolioID,
+		map[string]interface{}{"name": "Renamed", "slug": "renamed"}, nil)
+	if got := costBasis("renamed"); got != "301.00" {
+		t.Fatalf("expected position to follow the renamed portfolio, got %q", got)
+	}
+
+	ts.expect(http.StatusOK, http.MethodDelete, "/api/v1/operations/"+id, nil, nil)
+	if got := costBasis("renamed"); got != "" {
+		t.Fatalf("expected no position after delete, got %q", got)
+	}
+}
+
+func TestStaleQuotes(t *testing.T) {
+	ts := newTestServer(t)
+	ts.seed()
+	ts.create("/api/v1/stocks/operations", operation("PETR4"))
+	ts.create("/api/v1/stocks/operations", operation("VALE3"))
+
+	type position struct {
+		Gain       json.Number `json:"gain"`
+		LastPrice  json.Number `json:"lastPrice"`
+		QuoteStale bool        `json:"quoteStale"`
+		QuotedAt   *time.Time  `json:"quotedAt"`
+		Symbol     string      `json:"symbol"`
+	}
+	positions := func() map[string]position {
+		t.Helper()
+		portfolio := struct {
+			Items map[string][]position `json:"items"`
+		}{}
+		ts.expect(http.StatusOK, http.MethodGet, "/api/v1/portfolios/default", nil, &portfolio)
+		result := map[string]position{}
+		for _, p := range portfolio.Items["stocks"] {
+			result[p.Symbol] = p
+		}
+		return result
+	}
+
+	fresh := positions()
+	if fresh["PETR4"].QuotedAt == nil || fresh["PETR4"].QuoteStale {
+		t.Fatalf("expected a fresh quote, got %+v", fresh["PETR4"])
+	}
+	// VALE3 has no quote: its gain is unknown rather than a total loss.
+	if fresh["VALE3"].QuotedAt != nil || fresh["VALE3"].Gain != "0.00" {
+		t.Fatalf("unexpected unquoted position %+v", fresh["VALE3"])
+	}
+
+	ts.stub.Err = fmt.Errorf("finance API down")
+	stale := positions()
+	if !stale["PETR4"].QuoteStale || stale["PETR4"].LastPrice != "25" || stale["PETR4"].Gain != "49.00" {
+		t.Fatalf("expected the last known quote, got %+v", stale["PETR4"])
+	}
+	if !stale["VALE3"].QuoteStale {
+		t.Fatalf("expected VALE3 to be stale, got %+v", stale["VALE3"])
+	}
+}
+
+func TestPrices(t *testing.T) {
+	ts := newTestServer(t)
+	ts.seed()
+	ts.create("/api/v1/stocks/operations", operation("PETR4"))
+
+	csv := "itemType,symbol,date,price\n" +
+		"stocks,PETR4,2020-06-30,22\n" +
+		"stocks,PETR4,2020-12-30,30\n" +
+		"stocks,PETR4,2021-01-04,40\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/prices/import", bytes.NewBufferString(csv))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+	ts.server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "{\"imported\":3}\n" {
+		t.Fatalf("unexpected import response %d %q", rec.Code, rec.Body.String())
+	}
+	invalid := []map[string]interface{}{{"itemType": "stocks", "symbol": "PETR4", "date": "30/12/2020", "price": 1}}
+	ts.expect(http.StatusUnprocessableEntity, http.MethodPost, "/api/v1/prices/import", invalid, nil)
+
+	prices := []struct {
+		Price json.Number `json:"price"`
+	}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/prices/stocks/PETR4?from=2020-07-01", nil, &prices)
+	if len(prices) != 2 || prices[0].Price != "30" || prices[1].Price != "40" {
+		t.Fatalf("unexpected prices %+v", prices)
+	}
+
+	// Past years are valued at the stored price instead of the live quote.
+	portfolio := struct {
+		Gain  json.Number                         `json:"gain"`
+		Items map[string][]map[string]interface{} `json:"items"`
+	}{}
+	requests := ts.stub.Requests
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/portfolios/default?year=2020", nil, &portfolio)
+	stocks := portfolio.Items["stocks"]
+	if portfolio.Gain != "99.00" || len(stocks) != 1 || stocks[0]["lastPrice"] != 30.0 || stocks[0]["quoteStale"] != false {
+		t.Fatalf("unexpected portfolio %+v", portfolio)
+	}
+	if ts.stub.Requests != requests {
+		t.Fatalf("expected no finance API request for a past year, got %d", ts.stub.Requests-requests)
+	}
+}
+
+func TestPortfolioAsOf(t *testing.T) {
+	ts := newTestServer(t)
+	ts.seed()
+	ts.create("/api/v1/stocks/operations", operation("PETR4"))
+	// Operation dates are calendar days: a trade of July 1 is not part of
+	// June 30, even though the day ends later in São Paulo than in UTC.
+	nextDay := operation("PETR4")
+	nextDay["date"] = "2020-07-01T00:00:00Z"
+	ts.create("/api/v1/stocks/operations", nextDay)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/v1/prices/import", []map[string]interface{}{
+		{"itemType": "stocks", "symbol": "PETR4", "date": "2020-06-30", "price": 22},
+		{"itemType": "stocks", "symbol": "PETR4", "date": "2020-07-01", "price": 23},
+	}, nil)
+
+	position := func(asOf string) map[string]interface{} {
+		t.Helper()
+		portfolio := struct {
+			Items map[string][]map[string]interface{} `json:"items"`
+		}{}
+		ts.expect(http.StatusOK, http.MethodGet, "/api/v1/portfolios/default?asOf="+asOf, nil, &portfolio)
+		if stocks := portfolio.Items["stocks"]; len(stocks) == 1 {
+			return stocks[0]
+		}
+		return nil
+	}
+
+	for asOf, expected := range map[string][2]float64{
+		"2020-06-30": {10, 22},
+		"2020-06":    {10, 22},
+		"2020-Q2":    {10, 22},
+		"2020-07-01": {20, 23},
+		"2020-Q3":    {20, 23},
+		// Without a stored price the position is left unquoted rather than
+		// valued at the live quote.
+		"2020-Q1":    {10, 0},
+		"2020-01-02": {10, 0},
+	} {
+		p := position(asOf)
+		unquoted := expected[1] == 0
+		if p == nil || p["shares"] != expected[0] || p["lastPrice"] != expected[1] || p["quoteStale"] != unquoted {
+			t.Fatalf("asOf %s: unexpected position %v", asOf, p)
+		}
+	}
+	if p := position("2019"); p != nil {
+		t.Fatalf("expected no positions in 2019, got %v", p)
+	}
+	ts.expect(http.StatusUnprocessableEntity, http.MethodGet, "/api/v1/portfolios/default?asOf=2020-13", nil, nil)
+	ts.expect(http.StatusUnprocessableEntity, http.MethodGet, "/api/v1/portfolios?asOf=2020-Q5", nil, nil)
+}
+
+// unreachableDB fails to ping while err is set.
+type unreachableDB struct {
+	db.DB
+	err error
+}
+
+func (u *unreachableDB) WithContext(ctx context.Context) db.DB {
+	return u
+}
+
+func (u *unreachableDB) Ping() error {
+	return u.err
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	ts := newTestServer(t)
+	database := &unreachableDB{DB: db.NewMemorySession(), err: fmt.Errorf("connection refused")}
+	ts.server = NewServer(database)
+
+	ts.expect(http.StatusServiceUnavailable, http.MethodGet, "/healthcheck", nil, nil)
+	ts.expect(http.StatusServiceUnavailable, http.MethodPost, "/api/v1/brokers", map[string]interface{}{"name": "Broker"}, nil)
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/brokers", nil, nil)
+
+	database.err = nil
+	ts.expect(http.StatusOK, http.MethodGet, "/healthcheck", nil, nil)
+	ts.create("/api/v1/brokers", map[string]interface{}{"name": "Broker"})
+}
+
+func TestProbes(t *testing.T) {
+	ts := newTestServer(t)
+	probe := struct {
+		Status string `json:"status"`
+		Checks map[string]struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		} `json:"checks"`
+	}{}
+	ts.expect(http.StatusOK, http.MethodGet, "/livez", nil, &probe)
+	if probe.Status != "ok" || len(probe.Checks) != 0 {
+		t.Fatalf("unexpected liveness %+v", probe)
+	}
+
+	ts.expect(http.StatusOK, http.MethodGet, "/readyz", nil, &probe)
+	if probe.Status != "ok" || len(probe.Checks) != 3 {
+		t.Fatalf("unexpected readiness %+v", probe)
+	}
+	for name, check := range probe.Checks {
+		if check.Status != "ok" {
+			t.Fatalf("expected %s to be ok, got %+v", name, check)
+		}
+	}
+
+	// The market data check asks the finance API.
+	ts.stub.Err = fmt.Errorf("finance API down")
+	financeapi.DefaultQuotes = financeapi.NewQuoteClient(ts.stub, financeapi.QuoteOptions{ProbePath: "/stocks/?symbols=PETR4"})
+	ts.expect(http.StatusOK, http.MethodGet, "/readyz", nil, &probe)
+	if probe.Status != "degraded" || probe.Checks["marketdata"].Error != "finance API down" {
+		t.Fatalf("unexpected readiness %+v", probe)
+	}
+
+	ts.server = NewServer(&unreachableDB{DB: db.NewMemorySession(), err: fmt.Errorf("connection refused")})
+	ts.expect(http.StatusOK, http.MethodGet, "/livez", nil, nil)
+	ts.expect(http.StatusServiceUnavailable, http.MethodGet, "/readyz", nil, &probe)
+	if probe.Status != "fail" || probe.Checks["database"].Error != "connection refused" {
+		t.Fatalf("unexpected readiness %+v", probe)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	ts := newTestServer(t)
+	ts.seed()
+	ts.create("/api/v1/stocks/operations", operation("PETR4"))
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/portfolios/default", nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/v1/portfolios/missing", nil, nil)
+
+	rec := httptest.NewRecorder()
+	ts.server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected metrics, got %d", rec.Code)
+	}
+	for _, expected := range []string{
+		`finance_wallet_http_requests_total{method="GET",route="/api/v1/portfolios/:id",status="404"}`,
+		`finance_wallet_db_operation_duration_seconds_count{backend="memory",collection="operations",operation="insert_one"}`,
+		`finance_wallet_financeapi_requests_total{item_type="stocks",outcome="success"}`,
+		`finance_wallet_quote_cache_lookups_total{result="miss"}`,
+		"finance_wallet_brokers 1",
+		"finance_wallet_portfolios 1",
+		`finance_wallet_operations{item_type="stocks"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), expected) {
+			t.Errorf("expected %s in metrics", expected)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	if _, err := tracing.Setup(Version); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t)
+	ts.seed()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/portfolios/default", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ts.server.ServeHTTP(httptest.NewRecorder(), req)
+
+	var server sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "GET /api/v1/portfolios/:id" {
+			server = span
+		}
+	}
+	if server == nil {
+		t.Fatal("expected a span of the request")
+	}
+	if server.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected the trace of the request headers, got %s", server.SpanContext().TraceID())
+	}
+	children := 0
+	for _, span := range recorder.Ended() {
+		if strings.HasPrefix(span.Name(), "db.") && span.Parent().SpanID() == server.SpanContext().SpanID() {
+			children++
+		}
+	}
+	if children == 0 {
+		t.Fatal("expected database spans under the request span")
+	}
+}
+
+func TestLogCorrelation(t *testing.T) {
+	ts := newTestServer(t)
+	var output bytes.Buffer
+	formatter, level := log.StandardLogger().Formatter, log.GetLevel()
+	log.SetOutput(&output)
+	log.SetFormatter(&log.JSONFormatter{})
+	log.SetLevel(log.DebugLevel)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFormatter(formatter)
+		log.SetLevel(level)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/brokers", nil)
+	req.Header.Set(echo.HeaderXRequestID, "request-1")
+	req.Header.Set("X-Actor", "alice")
+	ts.server.ServeHTTP(httptest.NewRecorder(), req)
+
+	found := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("expected JSON logs, got %q", line)
+		}
+		if entry["request_id"] == "request-1" && entry["actor"] == "alice" {
+			found[fmt.Sprint(entry["msg"])] = true
+		}
+	}
+	for _, msg := range []string{"Retrieving all brokers", "[DB] GetAll"} {
+		if !found[msg] {
+			t.Fatalf("expected %q to be correlated with the request, got %v", msg, found)
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	ts := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/brokers", nil)
+	req.Header.Set(echo.HeaderXForwardedProto, "https")
+	rec := httptest.NewRecorder()
+	ts.server.ServeHTTP(rec, req)
+	for header, expected := range map[string]string{
+		echo.HeaderXContentTypeOptions:      "nosniff",
+		echo.HeaderContentSecurityPolicy:    apiPolicy,
+		echo.HeaderStrictTransportSecurity:  "max-age=31536000; includeSubdomains",
+		echo.HeaderXFrameOptions:            "DENY",
+		echo.HeaderAccessControlAllowOrigin: "",
+	} {
+		if rec.Header().Get(header) != expected {
+			t.Errorf("expected %s '%s', got '%s'", header, expected, rec.Header().Get(header))
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	ts.server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/swagger/index.html", nil))
+	if rec.Header().Get(echo.HeaderContentSecurityPolicy) != swaggerUIPolicy {
+		t.Errorf("expected the swagger UI policy, got '%s'", rec.Header().Get(echo.HeaderContentSecurityPolicy))
+	}
+	if rec.Header().Get(echo.HeaderStrictTransportSecurity) != "" {
+		t.Error("expected no HSTS over plain HTTP")
+	}
+}
+
+func TestCORS(t *testing.T) {
+	previous := viper.Get("cors.origins")
+	viper.Set("cors.origins", "https://wallet.example.com")
+	t.Cleanup(func() { viper.Set("cors.origins", previous) })
+	ts := newTestServer(t)
+
+	for origin, expected := range map[string]string{
+		"https://wallet.example.com": "https://wallet.example.com",
+		"https://evil.example.com":   "",
+	} {
+		req := httptest.NewRequest(http.MethodOptions, "/api/v1/brokers", nil)
+		req.Header.Set(echo.HeaderOrigin, origin)
+		req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+		rec := httptest.NewRecorder()
+		ts.server.ServeHTTP(rec, req)
+		if rec.Header().Get(echo.HeaderAccessControlAllowOrigin) != expected {
+			t.Errorf("expected origin %s to be answered with '%s', got '%s'", origin, expected, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+		}
+	}
+}
+
+func writeCertificate(t *testing.T, certPath, keyPath string, modTime time.Time) *tls.Certificate {
+	t.Helper()
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, block := range map[string]*pem.Block{
+		certPath: {Type: "CERTIFICATE", Bytes: cert.Certificate[0]},
+		keyPath:  {Type: "PRIVATE KEY", Bytes: key},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cert
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first := writeCertificate(t, certPath, keyPath, time.Now().Add(-time.Hour))
+	reloader, err := newCertificateReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, _ := reloader.GetCertificate(nil); !bytes.Equal(cert.Certificate[0], first.Certificate[0]) {
+		t.Fatal("expected the first certificate")
+	}
+
+	second := writeCertificate(t, certPath, keyPath, time.Now())
+	if cert, _ := reloader.GetCertificate(nil); !bytes.Equal(cert.Certificate[0], second.Certificate[0]) {
+		t.Fatal("expected the certificate to be reloaded")
+	}
+
+	if err := os.WriteFile(keyPath, []byte("broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(keyPath, time.Now().Add(time.Hour), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if cert, _ := reloader.GetCertificate(nil); !bytes.Equal(cert.Certificate[0], second.Certificate[0]) {
+		t.Fatal("expected the previous certificate to be kept")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	for key, value := range map[string]interface{}{"ratelimit.portfolios.rate": 0.5, "ratelimit.portfolios.burst": 2} {
+		previous := viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, previous) })
+	}
+	ts := newTestServer(t)
+
+	requests := 0
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		requests++
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/portfolios", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.9")
+		// A new token on each request does not get a new bucket.
+		req.Header.Set(echo.HeaderAuthorization, fmt.Sprintf("Bearer %d", requests))
+		req.Header.Set(echo.HeaderOrigin, "https://wallet.example.com")
+		rec := httptest.NewRecorder()
+		ts.server.ServeHTTP(rec, req)
+		return rec
+	}
+	for i := 0; i < 2; i++ {
+		if rec := get("192.0.2.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("expected request %d within the burst to pass, got %d", i+1, rec.Code)
+		}
+	}
+	rec := get("192.0.2.1:1234")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Fatalf("expected 429 retrying after 2 seconds, got %d and '%s'", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec.Header().Get(echo.HeaderAccessControlAllowOrigin) == "" {
+		t.Fatal("expected the refused request to carry CORS headers")
+	}
+	if rec := get("192.0.2.2:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("expected other clients to be limited separately, got %d", rec.Code)
+	}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/v1/brokers", nil, nil)
+	ts.expect(http.StatusOK, http.MethodGet, "/healthcheck", nil, nil)
+}
+
+func TestBodyLimit(t *testing.T) {
+	ts := newTestServer(t)
+	name := strings.Repeat("x", 2<<20)
+	ts.expect(http.StatusRequestEntityTooLarge, http.MethodPost, "/api/v1/brokers", map[string]string{"name": name, "slug": "big"}, nil)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+	// Embedded so the configured timezone loads on images without zoneinfo.
+	_ "time/tzdata"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+var quarterPattern = regexp.MustCompile(`^(\d{4})-Q([1-4])$`)
+
+// location returns the configured timezone, where dates begin and end.
+func location() *time.Location {
+	name := viper.GetString("timezone")
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Warnf("[API] Invalid timezone '%s', using UTC: %v", name, err)
+		return time.UTC
+	}
+	return loc
+}
+
+// endOf returns the last instant of the period in value: a day
+// (2024-06-30), a month (2024-06), a quarter (2024-Q2) or a year (2024).
+func endOf(value string, loc *time.Location) (time.Time, error) {
+	var start time.Time
+	var next func(time.Time) time.Time
+	if m := quarterPattern.FindStringSubmatch(value); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		quarter, _ := strconv.Atoi(m[2])
+		start = time.Date(year, time.Month(3*quarter-2), 1, 0, 0, 0, 0, loc)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 3, 0) }
+	} else {
+		layouts := []struct {
+			layout string
+			next   func(time.Time) time.Time
+		}{
+			{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+			{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+			{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+		}
+		for _, l := range layouts {
+			if t, err := time.ParseInLocation(l.layout, value, loc); err == nil {
+				start, next = t, l.next
+				break
+			}
+		}
+		if next == nil {
+			return time.Time{}, fmt.Errorf("invalid date '%s'", value)
+		}
+	}
+	return next(start).Add(-time.Nanosecond), nil
+}
+
+// getAsOf returns the date to value portfolios at: the end of the period
+// in the asOf parameter, the end of the year parameter, or the zero time
+// for now.
+func getAsOf(c echo.Context) (time.Time, error) {
+	loc := location()
+	if asOf := c.QueryParam("asOf"); asOf != "" {
+		return endOf(asOf, loc)
+	}
+	if year := c.QueryParam("year"); year != "" {
+		if _, err := strconv.Atoi(year); err != nil {
+			return time.Time{}, fmt.Errorf("invalid year '%s'", year)
+		}
+		return endOf(year, loc)
+	}
+	return time.Time{}, nil
+}
@@ -9,8 +9,8 @@ import (
 
 	"github.com/gosimple/slug"
 	"github.com/labstack/echo/v4"
+	"github.com/mfinancecombr/finance-wallet-api/db"
 	"github.com/mfinancecombr/finance-wallet-api/wallet"
-	log "github.com/sirupsen/logrus"
 )
 
 // broker godoc
@@ -25,9 +25,9 @@ import (
 // @Param id path string true "Broker id"
 func (s *server) broker(c echo.Context) error {
 	slug := c.Param("id")
-	log.Debugf("[API] Retrieving broker slug: %s", slug)
+	logger(c).Debugf("[API] Retrieving broker slug: %s", slug)
 	result := &wallet.Broker{}
-	if err := s.db.GetBySlug(slug, result); err != nil {
+	if err := s.requestDB(c).GetBySlug(slug, result); err != nil {
 		errMsg := fmt.Sprintf("Error on retrieve broker id '%s': %v", slug, err)
 		return logAndReturnError(c, errMsg)
 	}
@@ -47,8 +47,8 @@ func (s *server) broker(c echo.Context) error {
 // @Failure 500 {object} api.ErrorMessage
 // @Router /brokers [get]
 func (s *server) brokers(c echo.Context) error {
-	log.Debug("Retrieving all brokers")
-	result, err := s.db.GetAll(&wallet.Broker{})
+	logger(c).Debug("Retrieving all brokers")
+	result, err := s.requestDB(c).GetAll(&wallet.Broker{})
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on retrieve brokers: %v", err)
 		return logAndReturnError(c, errMsg)
@@ -62,11 +62,12 @@ func (s *server) brokers(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Success 200 {array} interface{}
+// @Failure 409 {object} api.ErrorMessage
 // @Failure 422 {object} api.ErrorMessage
 // @Failure 500 {object} api.ErrorMessage
 // @Router /brokers [post]
 func (s *server) brokersAdd(c echo.Context) error {
-	log.Debug("Insert brokers data")
+	logger(c).Debug("Insert brokers data")
 
 	broker := &wallet.Broker{}
 	if err := c.Bind(broker); err != nil {
@@ -81,10 +82,14 @@ func (s *server) brokersAdd(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
 	}
 
-	result, err := s.db.Create(broker)
+	if err := s.checkSlugAvailable(c, broker.Slug, "", &wallet.Broker{}); err != nil {
+		return returnReferenceError(c, err)
+	}
+
+	result, err := s.auditedDB(c).Create(broker)
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on insert broker: %v", err)
-		return logAndReturnError(c, errMsg)
+		return returnWriteError(c, errMsg, err)
 	}
 
 	return c.JSON(http.StatusOK, result)
@@ -97,17 +102,31 @@ func (s *server) brokersAdd(c echo.Context) error {
 // @Produce json
 // @Success 200 {array} interface{}
 // @Failure 404 {object} api.ErrorMessage
+// @Failure 409 {object} api.ErrorMessage
+// @Failure 422 {object} api.ErrorMessage
 // @Failure 500 {object} api.ErrorMessage
 // @Router /brokers/{id} [delete]
 // @Param id path string true "Broker id"
+// @Param onDelete query string false "block, cascade or reassign referencing operations"
+// @Param reassignTo query string false "broker slug receiving the operations when reassigning"
 func (s *server) brokersDelete(c echo.Context) error {
 	id := c.Param("id")
-	log.Debugf("Deleting %s data", id)
-	result, err := s.db.Delete("brokers", id)
-	if err != nil {
-		errMsg := fmt.Sprintf("Error on delete broker '%s': %v", id, err)
+	logger(c).Debugf("Deleting %s data", id)
+
+	broker := &wallet.Broker{}
+	if err := s.requestDB(c).Get(id, broker); err != nil {
+		errMsg := fmt.Sprintf("Error on retrieve broker '%s': %v", id, err)
 		return logAndReturnError(c, errMsg)
 	}
+	if broker.Name == "" {
+		errMsg := fmt.Sprintf("Broker '%s' not found", id)
+		return c.JSON(http.StatusNotFound, errorMessage(errMsg))
+	}
+
+	result, err := s.deleteReferenced(c, "brokers", id, db.BrokerSlugField, broker.Slug, &wallet.Broker{})
+	if err != nil {
+		return returnReferenceError(c, err)
+	}
 	return c.JSON(http.StatusOK, result)
 }
 
@@ -118,13 +137,14 @@ func (s *server) brokersDelete(c echo.Context) error {
 // @Produce json
 // @Success 200 {array} interface{}
 // @Failure 404 {object} api.ErrorMessage
+// @Failure 409 {object} api.ErrorMessage
 // @Failure 422 {object} api.ErrorMessage
 // @Failure 500 {object} api.ErrorMessage
 // @Router /brokers/{id} [put]
 // @Param id path string true "Broker id"
 func (s *server) brokersUpdate(c echo.Context) error {
 	id := c.Param("id")
-	log.Debugf("Updating %s data", id)
+	logger(c).Debugf("Updating %s data", id)
 
 	broker := &wallet.Broker{}
 	if err := c.Bind(broker); err != nil {
@@ -137,10 +157,31 @@ func (s *server) brokersUpdate(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
 	}
 
-	result, err := s.db.Update(id, broker)
+	current := &wallet.Broker{}
+	if err := s.requestDB(c).Get(id, current); err != nil {
+		errMsg := fmt.Sprintf("Error on retrieve broker '%s': %v", id, err)
+		return logAndReturnError(c, errMsg)
+	}
+	if current.Name == "" {
+		errMsg := fmt.Sprintf("Broker '%s' not found", id)
+		return c.JSON(http.StatusNotFound, errorMessage(errMsg))
+	}
+
+	var result *db.UpdateResult
+	var err error
+	if broker.Slug == current.Slug {
+		broker.Aliases = current.Aliases
+		result, err = s.auditedDB(c).Update(id, broker)
+	} else {
+		if err := s.checkSlugAvailable(c, broker.Slug, current.ID, &wallet.Broker{}); err != nil {
+			return returnReferenceError(c, err)
+		}
+		broker.Aliases = renameAliases(current.Aliases, current.Slug, broker.Slug)
+		result, err = s.auditedDB(c).Rename(id, broker, db.BrokerSlugField, current.Slug, broker.Slug)
+	}
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on update broker: %v", err)
-		return logAndReturnError(c, errMsg)
+		return returnWriteError(c, errMsg, err)
 	}
 
 	if result.MatchedCount != 0 {
@@ -9,12 +9,11 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/mfinancecombr/finance-wallet-api/wallet"
-	log "github.com/sirupsen/logrus"
 )
 
 func (s *server) getAllCertificatesOfDepositOperations(c echo.Context) error {
-	log.Debug("[API] Retrieving all certificates of deposit operations")
-	result, err := s.db.GetAll(wallet.CertificateOfDeposit{})
+	logger(c).Debug("[API] Retrieving all certificates of deposit operations")
+	result, err := s.requestDB(c).GetAll(wallet.CertificateOfDeposit{})
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on retrieve certificates of deposit operations: %v", err)
 		return logAndReturnError(c, errMsg)
@@ -34,9 +33,9 @@ func (s *server) getAllCertificatesOfDepositOperations(c echo.Context) error {
 // @Param id path string true "Operation id"
 func (s *server) getCertificateOfDepositOperationByID(c echo.Context) error {
 	id := c.Param("id")
-	log.Debugf("[API] Retrieving certificate of deposit operation with id: %s", id)
+	logger(c).Debugf("[API] Retrieving certificate of deposit operation with id: %s", id)
 	result := &wallet.CertificateOfDeposit{}
-	if err := s.db.Get(id, result); err != nil {
+	if err := s.requestDB(c).Get(id, result); err != nil {
 		errMsg := fmt.Sprintf("Error on retrieve '%s' operations: %v", id, err)
 		return logAndReturnError(c, errMsg)
 	}
@@ -57,7 +56,7 @@ func (s *server) getCertificateOfDepositOperationByID(c echo.Context) error {
 // @Failure 500 {object} api.ErrorMessage
 // @Router /certificates-of-deposit/operations [post]
 func (s *server) insertCertificateOfDepositOperation(c echo.Context) error {
-	log.Debugf("[API] Inserting certificate of deposit operation")
+	logger(c).Debugf("[API] Inserting certificate of deposit operation")
 
 	data := wallet.NewCertificateOfDeposit()
 
@@ -71,7 +70,11 @@ func (s *server) insertCertificateOfDepositOperation(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
 	}
 
-	result, err := s.db.Create(data)
+	if err := s.checkOperationReferences(c, data); err != nil {
+		return returnReferenceError(c, err)
+	}
+
+	result, err := s.auditedDB(c).Create(data)
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on insert certificate of deposit: %v", err)
 		return logAndReturnError(c, errMsg)
@@ -93,7 +96,7 @@ func (s *server) insertCertificateOfDepositOperation(c echo.Context) error {
 // @Param id path string true "Operation id"
 func (s *server) updateCertificateOfDepositOperationByID(c echo.Context) error {
 	id := c.Param("id")
-	log.Debugf("[API] Updating certificate of deposit operation with id %s", id)
+	logger(c).Debugf("[API] Updating certificate of deposit operation with id %s", id)
 
 	data := wallet.NewCertificateOfDeposit()
 
@@ -107,7 +110,11 @@ func (s *server) updateCertificateOfDepositOperationByID(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
 	}
 
-	result, err := s.db.Update(id, data)
+	if err := s.checkOperationReferences(c, data); err != nil {
+		return returnReferenceError(c, err)
+	}
+
+	result, err := s.auditedDB(c).Update(id, data)
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on update certificate of deposit: %v", err)
 		return logAndReturnError(c, errMsg)
@@ -8,7 +8,6 @@ import (
 	"net/http"
 
 	"github.com/labstack/echo/v4"
-	log "github.com/sirupsen/logrus"
 )
 
 type ErrorMessage struct {
@@ -20,6 +19,6 @@ func errorMessage(m string) ErrorMessage {
 }
 
 func logAndReturnError(c echo.Context, m string) error {
-	log.Error(fmt.Sprintf("[API] %s", m))
+	logger(c).Error(fmt.Sprintf("[API] %s", m))
 	return c.JSON(http.StatusInternalServerError, errorMessage(m))
 }
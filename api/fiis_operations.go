@@ -9,12 +9,11 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/mfinancecombr/finance-wallet-api/wallet"
-	log "github.com/sirupsen/logrus"
 )
 
 func (s *server) getAllFIIOperations(c echo.Context) error {
-	log.Debug("[API] Retrieving all stocks operations")
-	result, err := s.db.GetAll(wallet.FII{})
+	logger(c).Debug("[API] Retrieving all stocks operations")
+	result, err := s.requestDB(c).GetAll(wallet.FII{})
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on retrieve operations: %v", err)
 		return logAndReturnError(c, errMsg)
@@ -34,9 +33,9 @@ func (s *server) getAllFIIOperations(c echo.Context) error {
 // @Param id path string true "Operation id"
 func (s *server) getFIIOperationByID(c echo.Context) error {
 	id := c.Param("id")
-	log.Debugf("[API] Retrieving stock operation with id: %s", id)
+	logger(c).Debugf("[API] Retrieving stock operation with id: %s", id)
 	result := &wallet.FII{}
-	if err := s.db.Get(id, result); err != nil {
+	if err := s.requestDB(c).Get(id, result); err != nil {
 		errMsg := fmt.Sprintf("Error on retrieve '%s' operations: %v", id, err)
 		return logAndReturnError(c, errMsg)
 	}
@@ -57,7 +56,7 @@ func (s *server) getFIIOperationByID(c echo.Context) error {
 // @Failure 500 {object} api.ErrorMessage
 // @Router /fiis/operations [post]
 func (s *server) insertFIIOperation(c echo.Context) error {
-	log.Debugf("[API] Inserting stock operation")
+	logger(c).Debugf("[API] Inserting stock operation")
 
 	data := wallet.NewFII()
 
@@ -71,7 +70,11 @@ func (s *server) insertFIIOperation(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
 	}
 
-	result, err := s.db.Create(data)
+	if err := s.checkOperationReferences(c, data); err != nil {
+		return returnReferenceError(c, err)
+	}
+
+	result, err := s.auditedDB(c).Create(data)
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on insert FII: %v", err)
 		return logAndReturnError(c, errMsg)
@@ -93,7 +96,7 @@ func (s *server) insertFIIOperation(c echo.Context) error {
 // @Param id path string true "Operation id"
 func (s *server) updateFIIOperationByID(c echo.Context) error {
 	id := c.Param("id")
-	log.Debugf("[API] Updating stock operation with id %s", id)
+	logger(c).Debugf("[API] Updating stock operation with id %s", id)
 
 	data := wallet.NewFII()
 
@@ -107,7 +110,11 @@ func (s *server) updateFIIOperationByID(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
 	}
 
-	result, err := s.db.Update(id, data)
+	if err := s.checkOperationReferences(c, data); err != nil {
+		return returnReferenceError(c, err)
+	}
+
+	result, err := s.auditedDB(c).Update(id, data)
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on update FII: %v", err)
 		return logAndReturnError(c, errMsg)
@@ -7,13 +7,14 @@ import (
 	"net/http"
 
 	"github.com/labstack/echo/v4"
-	log "github.com/sirupsen/logrus"
 )
 
 func (s *server) healthcheck(c echo.Context) error {
-	log.Debug("[API] Ping")
-	if err := s.db.Ping(); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	logger(c).Debug("[API] Ping")
+	err := s.requestDB(c).Ping()
+	s.setReady(err == nil)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
 	}
 	return c.String(http.StatusOK, "WORKING")
 }
@@ -0,0 +1,89 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mfinancecombr/finance-wallet-api/db"
+	"github.com/spf13/viper"
+)
+
+const anonymousActor = "anonymous"
+
+// requestDB returns the database bound to the request, so its queries are
+// cancelled when the client goes away.
+func (s *server) requestDB(c echo.Context) db.DB {
+	return s.db.WithContext(c.Request().Context())
+}
+
+// actor returns who makes a request, as identified by the configured
+// request header. The header is set by the client and not authenticated, so
+// the actor is advisory: it tells changes apart, but can be spoofed unless a
+// proxy in front of the API sets it.
+func actor(c echo.Context) string {
+	if actor := c.Request().Header.Get(viper.GetString("audit.actor.header")); actor != "" {
+		return actor
+	}
+	return anonymousActor
+}
+
+// auditedDB returns the request database recording changes as made by the
+// actor of the request.
+func (s *server) auditedDB(c echo.Context) db.DB {
+	return s.requestDB(c).WithActor(actor(c))
+}
+
+// getOperationHistory godoc
+// @Summary Get operation history
+// @Description get all changes made to some operation, newest first
+// @Accept json
+// @Produce json
+// @Success 200 {array} wallet.HistoryEvent
+// @Failure 500 {object} api.ErrorMessage
+// @Router /operations/{id}/history [get]
+// @Param id path string true "Operation id"
+func (s *server) getOperationHistory(c echo.Context) error {
+	id := c.Param("id")
+	logger(c).Debugf("[API] Retrieving history of operation %s", id)
+	result, err := s.requestDB(c).GetHistory(id)
+	if err != nil {
+		errMsg := fmt.Sprintf("Error on retrieve '%s' history: %v", id, err)
+		return logAndReturnError(c, errMsg)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// getAuditFeed godoc
+// @Summary List all changes
+// @Description get changes made to all documents, newest first
+// @Accept json
+// @Produce json
+// @Success 200 {array} wallet.HistoryEvent
+// @Failure 422 {object} api.ErrorMessage
+// @Failure 500 {object} api.ErrorMessage
+// @Router /history [get]
+// @Param collection query string false "filter by collection"
+// @Param limit query int false "maximum number of events, defaults to 100"
+func (s *server) getAuditFeed(c echo.Context) error {
+	logger(c).Debug("[API] Retrieving audit feed")
+	limit := int64(100)
+	if limitString := c.QueryParam("limit"); limitString != "" {
+		var err error
+		limit, err = strconv.ParseInt(limitString, 10, 64)
+		if err != nil || limit <= 0 {
+			errMsg := fmt.Sprintf("Invalid limit '%s'", limitString)
+			return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
+		}
+	}
+	result, err := s.requestDB(c).GetAuditFeed(c.QueryParam("collection"), limit)
+	if err != nil {
+		errMsg := fmt.Sprintf("Error on retrieve audit feed: %v", err)
+		return logAndReturnError(c, errMsg)
+	}
+	return c.JSON(http.StatusOK, result)
+}
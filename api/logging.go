@@ -0,0 +1,27 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package api
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/mfinancecombr/finance-wallet-api/logging"
+	log "github.com/sirupsen/logrus"
+)
+
+// correlateLogs binds the request ID and actor to the request context, so
+// every log entry of the request carries them.
+func correlateLogs(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		id := c.Response().Header().Get(echo.HeaderXRequestID)
+		ctx := logging.WithRequest(req.Context(), id, actor(c))
+		c.SetRequest(req.WithContext(ctx))
+		return next(c)
+	}
+}
+
+// logger returns the log entry of a request.
+func logger(c echo.Context) *log.Entry {
+	return log.WithContext(c.Request().Context())
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mfinancecombr/finance-wallet-api/db"
+	"github.com/mfinancecombr/finance-wallet-api/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// requestRoute returns the route pattern matched by the request.
+func requestRoute(c echo.Context) string {
+	if route := c.Path(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+// responseStatus returns the status of the response to a handler returning
+// err. Errors are written by the error handler once the middlewares
+// return, so their status is taken from them.
+func responseStatus(c echo.Context, err error) int {
+	if he, ok := err.(*echo.HTTPError); ok {
+		return he.Code
+	}
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	return c.Response().Status
+}
+
+// measureRequests records the count and latency of requests by route.
+func measureRequests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		status := responseStatus(c, err)
+		route := requestRoute(c)
+		method := c.Request().Method
+		metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+var (
+	brokersDesc = prometheus.NewDesc(
+		"finance_wallet_brokers", "Brokers not in the trash.", nil, nil)
+	portfoliosDesc = prometheus.NewDesc(
+		"finance_wallet_portfolios", "Portfolios not in the trash.", nil, nil)
+	operationsDesc = prometheus.NewDesc(
+		"finance_wallet_operations", "Operations not in the trash by item type.", []string{"item_type"}, nil)
+)
+
+// walletCollector counts the documents of the wallet on each scrape.
+type walletCollector struct {
+	db db.DB
+}
+
+func (w *walletCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- brokersDesc
+	ch <- portfoliosDesc
+	ch <- operationsDesc
+}
+
+func (w *walletCollector) Collect(ch chan<- prometheus.Metric) {
+	for desc, collectionName := range map[*prometheus.Desc]string{
+		brokersDesc:    "brokers",
+		portfoliosDesc: "portfolios",
+	} {
+		count, err := w.db.Count(collectionName)
+		if err != nil {
+			log.Warnf("[API] Error on count %s: %v", collectionName, err)
+			ch <- prometheus.NewInvalidMetric(desc, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(count))
+	}
+	counts, err := w.db.CountOperationsByItemType()
+	if err != nil {
+		log.Warnf("[API] Error on count operations: %v", err)
+		ch <- prometheus.NewInvalidMetric(operationsDesc, err)
+		return
+	}
+	for itemType, count := range counts {
+		ch <- prometheus.MustNewConstMetric(operationsDesc, prometheus.GaugeValue, float64(count), itemType)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"net/http"
 
 	"github.com/labstack/echo/v4"
-	log "github.com/sirupsen/logrus"
 )
 
 // getAllOperations godoc
@@ -20,8 +19,8 @@ import (
 // @Failure 500 {object} api.ErrorMessage
 // @Router /operations [get]
 func (s *server) getAllOperations(c echo.Context) error {
-	log.Debug("[API] Retrieving all operations")
-	result, err := s.db.GetAllOperations()
+	logger(c).Debug("[API] Retrieving all operations")
+	result, err := s.requestDB(c).GetAllOperations()
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on retrieve all operations: %v", err)
 		return logAndReturnError(c, errMsg)
@@ -38,8 +37,8 @@ func (s *server) getAllOperations(c echo.Context) error {
 // @Failure 500 {object} api.ErrorMessage
 // @Router /purchases [get]
 func (s *server) getAllPurchases(c echo.Context) error {
-	log.Debug("[API] Retrieving all purchases operations")
-	result, err := s.db.GetAllPurchases()
+	logger(c).Debug("[API] Retrieving all purchases operations")
+	result, err := s.requestDB(c).GetAllPurchases()
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on retrieve purchases operations: %v", err)
 		return logAndReturnError(c, errMsg)
@@ -56,8 +55,8 @@ func (s *server) getAllPurchases(c echo.Context) error {
 // @Failure 500 {object} api.ErrorMessage
 // @Router /sales [get]
 func (s *server) getAllSales(c echo.Context) error {
-	log.Debug("[API] Retrieving all sales operations")
-	result, err := s.db.GetAllSales()
+	logger(c).Debug("[API] Retrieving all sales operations")
+	result, err := s.requestDB(c).GetAllSales()
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on retrieve sales operations: %v", err)
 		return logAndReturnError(c, errMsg)
@@ -77,8 +76,8 @@ func (s *server) getAllSales(c echo.Context) error {
 // @Param id path string true "Operation id"
 func (s *server) deleteOperationByID(c echo.Context) error {
 	id := c.Param("id")
-	log.Debugf("Deleting %s data", id)
-	result, err := s.db.Delete("operations", id)
+	logger(c).Debugf("Deleting %s data", id)
+	result, err := s.auditedDB(c).Delete("operations", id)
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on delete operation '%s': %v", id, err)
 		return logAndReturnError(c, errMsg)
@@ -6,27 +6,13 @@ package api
 import (
 	"fmt"
 	"net/http"
-	"strconv"
-	"time"
 
 	"github.com/gosimple/slug"
 	"github.com/labstack/echo/v4"
+	"github.com/mfinancecombr/finance-wallet-api/db"
 	"github.com/mfinancecombr/finance-wallet-api/wallet"
-	log "github.com/sirupsen/logrus"
 )
 
-func getYear(c echo.Context) (int, error) {
-	var year int
-	yearString := c.QueryParam("year")
-	if yearString != "" {
-		return strconv.Atoi(yearString)
-	} else {
-		t := time.Now()
-		year = t.Year()
-	}
-	return year, nil
-}
-
 // portfolio godoc
 // @Summary Get a portfolio
 // @Description get all portfolio data
@@ -34,22 +20,24 @@ func getYear(c echo.Context) (int, error) {
 // @Produce json
 // @Success 200 {object} wallet.Portfolio
 // @Failure 404 {object} api.ErrorMessage
+// @Failure 422 {object} api.ErrorMessage
 // @Failure 500 {object} api.ErrorMessage
 // @Router /portfolios/{slug} [get]
 // @Param slug path string true "Broker slug"
-// @Param year query string false "filter by year"
+// @Param asOf query string false "value at the end of a day (2024-06-30), month (2024-06), quarter (2024-Q2) or year (2024), defaults to now"
+// @Param year query string false "value at the end of a year"
 func (s *server) portfolio(c echo.Context) error {
 	slug := c.Param("id")
-	log.Debugf("[API] Retrieving %s data...", slug)
+	logger(c).Debugf("[API] Retrieving %s data...", slug)
 
-	year, err := getYear(c)
+	asOf, err := getAsOf(c)
 	if err != nil {
-		errMsg := fmt.Sprintf("[API] Error on get year: %v", err)
-		return logAndReturnError(c, errMsg)
+		errMsg := fmt.Sprintf("Error on get date: %v", err)
+		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
 	}
 
 	result := &wallet.Portfolio{}
-	if err := s.db.GetBySlug(slug, result); err != nil {
+	if err := s.requestDB(c).GetBySlug(slug, result); err != nil {
 		errMsg := fmt.Sprintf("Error on get portfolio '%s': %v", slug, err)
 		return logAndReturnError(c, errMsg)
 	}
@@ -59,7 +47,7 @@ func (s *server) portfolio(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, errorMessage(errMsg))
 	}
 
-	if err := s.db.GetPortfolioData(result, year); err != nil {
+	if err := s.requestDB(c).GetPortfolioData(result, asOf); err != nil {
 		errMsg := fmt.Sprintf("Error on get portfolio '%s' items: %v", slug, err)
 		return logAndReturnError(c, errMsg)
 	}
@@ -73,33 +61,38 @@ func (s *server) portfolio(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Success 200 {array} wallet.Portfolio
+// @Failure 422 {object} api.ErrorMessage
 // @Failure 500 {object} api.ErrorMessage
 // @Router /portfolios [get]
-// @Param year query string false "filter by year"
+// @Param asOf query string false "value at the end of a day (2024-06-30), month (2024-06), quarter (2024-Q2) or year (2024), defaults to now"
+// @Param year query string false "value at the end of a year"
 func (s *server) portfolios(c echo.Context) error {
-	log.Debug("Retrieving all portfolios")
+	logger(c).Debug("Retrieving all portfolios")
 
-	year, err := getYear(c)
+	asOf, err := getAsOf(c)
 	if err != nil {
-		errMsg := fmt.Sprintf("[API] Error on get year: %v", err)
-		return logAndReturnError(c, errMsg)
+		errMsg := fmt.Sprintf("Error on get date: %v", err)
+		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
 	}
 
-	allPortfolios, err := s.db.GetAll(&wallet.Portfolio{})
+	allPortfolios, err := s.requestDB(c).GetAll(&wallet.Portfolio{})
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on get all portfolios: %v", err)
 		return logAndReturnError(c, errMsg)
 	}
 
-	portfolios := make([]wallet.Portfolio, len(allPortfolios))
+	pointers := make([]*wallet.Portfolio, len(allPortfolios))
 	for idx, p := range allPortfolios {
-		portfolio := p.(*wallet.Portfolio)
-		err := s.db.GetPortfolioData(portfolio, year)
-		if err != nil {
-			errMsg := fmt.Sprintf("Error on get portfolio items: %v", err)
-			return logAndReturnError(c, errMsg)
-		}
-		portfolios[idx] = *portfolio
+		pointers[idx] = p.(*wallet.Portfolio)
+	}
+	if err := s.requestDB(c).GetPortfoliosData(pointers, asOf); err != nil {
+		errMsg := fmt.Sprintf("Error on get portfolio items: %v", err)
+		return logAndReturnError(c, errMsg)
+	}
+
+	portfolios := make([]wallet.Portfolio, len(pointers))
+	for idx, p := range pointers {
+		portfolios[idx] = *p
 	}
 	return c.JSON(http.StatusOK, portfolios)
 }
@@ -110,11 +103,12 @@ func (s *server) portfolios(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Success 200 {object} interface{}
+// @Failure 409 {object} api.ErrorMessage
 // @Failure 422 {object} api.ErrorMessage
 // @Failure 500 {object} api.ErrorMessage
 // @Router /portfolios [post]
 func (s *server) portfoliosAdd(c echo.Context) error {
-	log.Debug("Insert portfolio data")
+	logger(c).Debug("Insert portfolio data")
 
 	portfolio := &wallet.Portfolio{}
 	if err := c.Bind(portfolio); err != nil {
@@ -129,10 +123,14 @@ func (s *server) portfoliosAdd(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
 	}
 
-	result, err := s.db.Create(portfolio)
+	if err := s.checkSlugAvailable(c, portfolio.Slug, "", &wallet.Portfolio{}); err != nil {
+		return returnReferenceError(c, err)
+	}
+
+	result, err := s.auditedDB(c).Create(portfolio)
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on insert portfolio: %v", err)
-		return logAndReturnError(c, errMsg)
+		return returnWriteError(c, errMsg, err)
 	}
 
 	return c.JSON(http.StatusOK, result)
@@ -145,17 +143,31 @@ func (s *server) portfoliosAdd(c echo.Context) error {
 // @Produce json
 // @Success 200 {object} interface{}
 // @Failure 404 {object} api.ErrorMessage
+// @Failure 409 {object} api.ErrorMessage
+// @Failure 422 {object} api.ErrorMessage
 // @Failure 500 {object} api.ErrorMessage
 // @Router /portfolios/{id} [delete]
 // @Param id path string true "Portfolio id"
+// @Param onDelete query string false "block, cascade or reassign referencing operations"
+// @Param reassignTo query string false "portfolio slug receiving the operations when reassigning"
 func (s *server) portfoliosDelete(c echo.Context) error {
 	id := c.Param("id")
-	log.Debugf("Deleting %s data", id)
-	result, err := s.db.Delete("portfolios", id)
-	if err != nil {
-		errMsg := fmt.Sprintf("Error on delete portolio '%s': %v", id, err)
+	logger(c).Debugf("Deleting %s data", id)
+
+	portfolio := &wallet.Portfolio{}
+	if err := s.requestDB(c).Get(id, portfolio); err != nil {
+		errMsg := fmt.Sprintf("Error on retrieve portfolio '%s': %v", id, err)
 		return logAndReturnError(c, errMsg)
 	}
+	if portfolio.Name == "" {
+		errMsg := fmt.Sprintf("Portfolio '%s' not found", id)
+		return c.JSON(http.StatusNotFound, errorMessage(errMsg))
+	}
+
+	result, err := s.deleteReferenced(c, "portfolios", id, db.PortfolioSlugField, portfolio.Slug, &wallet.Portfolio{})
+	if err != nil {
+		return returnReferenceError(c, err)
+	}
 	return c.JSON(http.StatusOK, result)
 }
 
@@ -166,13 +178,14 @@ func (s *server) portfoliosDelete(c echo.Context) error {
 // @Produce json
 // @Success 200 {object} wallet.Portfolio
 // @Failure 404 {object} api.ErrorMessage
+// @Failure 409 {object} api.ErrorMessage
 // @Failure 422 {object} api.ErrorMessage
 // @Failure 500 {object} api.ErrorMessage
 // @Router /portfolios/{id} [put]
 // @Param id path string true "Portfolio id"
 func (s *server) portfoliosUpdate(c echo.Context) error {
 	id := c.Param("id")
-	log.Debugf("Updating %s data", id)
+	logger(c).Debugf("Updating %s data", id)
 
 	portfolio := &wallet.Portfolio{}
 	if err := c.Bind(portfolio); err != nil {
@@ -185,10 +198,31 @@ func (s *server) portfoliosUpdate(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
 	}
 
-	result, err := s.db.Update(id, portfolio)
+	current := &wallet.Portfolio{}
+	if err := s.requestDB(c).Get(id, current); err != nil {
+		errMsg := fmt.Sprintf("Error on retrieve portfolio '%s': %v", id, err)
+		return logAndReturnError(c, errMsg)
+	}
+	if current.Name == "" {
+		errMsg := fmt.Sprintf("Portfolio '%s' not found", id)
+		return c.JSON(http.StatusNotFound, errorMessage(errMsg))
+	}
+
+	var result *db.UpdateResult
+	var err error
+	if portfolio.Slug == current.Slug {
+		portfolio.Aliases = current.Aliases
+		result, err = s.auditedDB(c).Update(id, portfolio)
+	} else {
+		if err := s.checkSlugAvailable(c, portfolio.Slug, current.ID, &wallet.Portfolio{}); err != nil {
+			return returnReferenceError(c, err)
+		}
+		portfolio.Aliases = renameAliases(current.Aliases, current.Slug, portfolio.Slug)
+		result, err = s.auditedDB(c).Rename(id, portfolio, db.PortfolioSlugField, current.Slug, portfolio.Slug)
+	}
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on update portfolio: %v", err)
-		return logAndReturnError(c, errMsg)
+		return returnWriteError(c, errMsg, err)
 	}
 
 	if result.MatchedCount != 0 {
@@ -0,0 +1,101 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mfinancecombr/finance-wallet-api/marketdata"
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+)
+
+// ImportResult reports how many prices were imported.
+type ImportResult struct {
+	Imported int64 `json:"imported"`
+}
+
+// importPrices godoc
+// @Summary Import prices
+// @Description import a price series, as CSV when the content type is text/csv or a JSON array otherwise, replacing stored prices of the same day
+// @Accept json
+// @Accept text/csv
+// @Produce json
+// @Success 200 {object} api.ImportResult
+// @Failure 422 {object} api.ErrorMessage
+// @Failure 500 {object} api.ErrorMessage
+// @Router /prices/import [post]
+func (s *server) importPrices(c echo.Context) error {
+	logger(c).Debug("[API] Importing prices")
+	format := marketdata.FormatJSON
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), "text/csv") {
+		format = marketdata.FormatCSV
+	}
+	records, err := marketdata.ReadRecords(c.Request().Body, format)
+	if err != nil {
+		errMsg := fmt.Sprintf("Error on read prices: %v", err)
+		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
+	}
+	prices := []wallet.Price{}
+	for i, r := range records {
+		date, err := r.ParseDate()
+		if err != nil {
+			errMsg := fmt.Sprintf("Invalid date '%s' on price %d", r.Date, i+1)
+			return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
+		}
+		p := wallet.Price{Date: date, ItemType: r.ItemType, Price: r.Price, Symbol: r.Symbol}
+		if err := c.Validate(p); err != nil {
+			errMsg := fmt.Sprintf("Invalid price %d: %v", i+1, err)
+			return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
+		}
+		prices = append(prices, p)
+	}
+	imported, err := s.requestDB(c).SavePrices(prices)
+	if err != nil {
+		errMsg := fmt.Sprintf("Error on save prices: %v", err)
+		return logAndReturnError(c, errMsg)
+	}
+	return c.JSON(http.StatusOK, ImportResult{Imported: imported})
+}
+
+// getPrices godoc
+// @Summary List prices
+// @Description get the stored prices of a symbol, oldest first
+// @Accept json
+// @Produce json
+// @Success 200 {array} wallet.Price
+// @Failure 422 {object} api.ErrorMessage
+// @Failure 500 {object} api.ErrorMessage
+// @Router /prices/{itemType}/{symbol} [get]
+// @Param itemType path string true "Item type"
+// @Param symbol path string true "Symbol"
+// @Param from query string false "first day, as YYYY-MM-DD"
+// @Param to query string false "last day, as YYYY-MM-DD"
+func (s *server) getPrices(c echo.Context) error {
+	itemType := c.Param("itemType")
+	symbol := c.Param("symbol")
+	logger(c).Debugf("[API] Retrieving %s/%s prices", itemType, symbol)
+	var dates [2]time.Time
+	for i, name := range []string{"from", "to"} {
+		value := c.QueryParam(name)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			errMsg := fmt.Sprintf("Invalid %s '%s'", name, value)
+			return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
+		}
+		dates[i] = date
+	}
+	result, err := s.requestDB(c).GetPrices(itemType, symbol, dates[0], dates[1])
+	if err != nil {
+		errMsg := fmt.Sprintf("Error on retrieve '%s' prices: %v", symbol, err)
+		return logAndReturnError(c, errMsg)
+	}
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mfinancecombr/finance-wallet-api/marketdata"
+	"github.com/spf13/viper"
+)
+
+// Probe and check statuses. Checks of optional dependencies degrade the
+// service instead of failing it.
+const (
+	statusOK       = "ok"
+	statusDegraded = "degraded"
+	statusFail     = "fail"
+)
+
+type Check struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+	// Critical checks make the service unready when failing.
+	Critical bool `json:"critical"`
+}
+
+type Probe struct {
+	Status  string           `json:"status"`
+	Version string           `json:"version"`
+	Uptime  string           `json:"uptime"`
+	Checks  map[string]Check `json:"checks,omitempty"`
+}
+
+// job is the state of a background job, as last reported by it.
+type job struct {
+	interval  time.Duration
+	lastRun   time.Time
+	lastError error
+}
+
+// jobs tracks the background jobs, so they can be checked for failures
+// and stalls.
+type jobs struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+// start registers a job running after each interval.
+func (j *jobs) start(name string, interval time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.jobs == nil {
+		j.jobs = map[string]*job{}
+	}
+	j.jobs[name] = &job{interval: interval, lastRun: time.Now()}
+}
+
+// done records a run of a job.
+func (j *jobs) done(name string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if jb, ok := j.jobs[name]; ok {
+		jb.lastRun = time.Now()
+		jb.lastError = err
+	}
+}
+
+// checks returns a check per job. Jobs that missed two runs are stalled.
+func (j *jobs) checks() map[string]Check {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	checks := map[string]Check{}
+	for name, jb := range j.jobs {
+		check := Check{Status: statusOK}
+		if jb.lastError != nil {
+			check = Check{Status: statusFail, Error: jb.lastError.Error()}
+		}
+		if since := time.Since(jb.lastRun); since > 2*jb.interval+time.Minute {
+			check = Check{Status: statusFail, Error: fmt.Sprintf("stalled, last run %s ago", since.Round(time.Second))}
+		}
+		checks["job:"+name] = check
+	}
+	return checks
+}
+
+// timed runs check, measuring its latency.
+func timed(critical bool, check func() error) Check {
+	start := time.Now()
+	err := check()
+	result := Check{
+		Status:    statusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Critical:  critical,
+	}
+	if err != nil {
+		result.Status = statusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (s *server) probe(checks map[string]Check) Probe {
+	status := statusOK
+	for _, check := range checks {
+		if check.Status == statusOK {
+			continue
+		}
+		if check.Critical {
+			status = statusFail
+			break
+		}
+		status = statusDegraded
+	}
+	return Probe{
+		Status:  status,
+		Version: Version,
+		Uptime:  time.Since(s.started).Round(time.Second).String(),
+		Checks:  checks,
+	}
+}
+
+// livez godoc
+// @Summary Liveness probe
+// @Description report whether the process is running, regardless of its dependencies
+// @Produce json
+// @Success 200 {object} api.Probe
+// @Router /livez [get]
+func (s *server) livez(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.probe(nil))
+}
+
+// readyz godoc
+// @Summary Readiness probe
+// @Description report the status and latency of each dependency; fails while a critical one fails
+// @Produce json
+// @Success 200 {object} api.Probe
+// @Failure 503 {object} api.Probe
+// @Router /readyz [get]
+func (s *server) readyz(c echo.Context) error {
+	timeout := viper.GetDuration("readyz.timeout") * time.Second
+	ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+	defer cancel()
+	database := s.db.WithContext(ctx)
+
+	checks := map[string]func() Check{
+		"database": func() Check {
+			return timed(true, database.Ping)
+		},
+		"migrations": func() Check {
+			return timed(true, func() error {
+				pending, err := database.PendingMigrations()
+				if err == nil && pending > 0 {
+					err = fmt.Errorf("%d pending migrations", pending)
+				}
+				return err
+			})
+		},
+		"marketdata": func() Check {
+			return timed(false, func() error { return marketdata.Check(ctx) })
+		},
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := s.jobs.checks()
+	for name := range checks {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			result := checks[name]()
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = result
+		}(name)
+	}
+	wg.Wait()
+
+	s.setReady(results["database"].Status == statusOK)
+	probe := s.probe(results)
+	if probe.Status == statusFail {
+		logger(c).Warnf("[API] Not ready: %+v", results)
+		return c.JSON(http.StatusServiceUnavailable, probe)
+	}
+	return c.JSON(http.StatusOK, probe)
+}
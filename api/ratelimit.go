@@ -0,0 +1,99 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/mfinancecombr/finance-wallet-api/config"
+	"github.com/mfinancecombr/finance-wallet-api/metrics"
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+)
+
+// routeGroup returns the rate limit group of a request, or "" for requests
+// outside the API, such as probes and metrics, which are never limited.
+func routeGroup(c echo.Context) string {
+	path := c.Path()
+	if !strings.HasPrefix(path, "/api/") {
+		return ""
+	}
+	switch c.Request().Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return "writes"
+	}
+	// Portfolios fan out to the finance API.
+	if strings.HasPrefix(path, "/api/v1/portfolios") {
+		return "portfolios"
+	}
+	return "default"
+}
+
+// client identifies who makes a request by its IP address. Headers such as
+// Authorization are not validated by the API, so keying by them would let
+// clients get a new bucket on each request.
+func client(c echo.Context) (string, error) {
+	return "ip:" + c.RealIP(), nil
+}
+
+// rateLimit limits the requests of each client with a token bucket per
+// route group, refilled at "ratelimit.<group>.rate" requests per second and
+// holding up to "ratelimit.<group>.burst" requests. Refused requests are
+// answered with 429 and a Retry-After header.
+func rateLimit() echo.MiddlewareFunc {
+	limiters := map[string]echo.MiddlewareFunc{}
+	for _, group := range config.RateLimitGroups {
+		group := group
+		limit := viper.GetFloat64(fmt.Sprintf("ratelimit.%s.rate", group))
+		retryAfter := strconv.Itoa(int(math.Ceil(1 / limit)))
+		limiters[group] = middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+			IdentifierExtractor: client,
+			Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+				Rate:  rate.Limit(limit),
+				Burst: viper.GetInt(fmt.Sprintf("ratelimit.%s.burst", group)),
+			}),
+			DenyHandler: func(c echo.Context, identifier string, err error) error {
+				metrics.RateLimited.WithLabelValues(group).Inc()
+				logger(c).Warnf("[API] Rate limit of %s exceeded by %s", group, identifier)
+				c.Response().Header().Set("Retry-After", retryAfter)
+				errMsg := fmt.Sprintf("Too many requests, retry in %s seconds", retryAfter)
+				return c.JSON(http.StatusTooManyRequests, errorMessage(errMsg))
+			},
+		})
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		limited := map[string]echo.HandlerFunc{}
+		for group, limiter := range limiters {
+			limited[group] = limiter(next)
+		}
+		return func(c echo.Context) error {
+			if !viper.GetBool("ratelimit.enabled") {
+				return next(c)
+			}
+			if handler, ok := limited[routeGroup(c)]; ok {
+				return handler(c)
+			}
+			return next(c)
+		}
+	}
+}
+
+// bodyLimitConfig refuses request bodies larger than "request.body.limit"
+// with 413. Imports are skipped, limited by "request.import.limit" instead.
+func bodyLimitConfig() middleware.BodyLimitConfig {
+	return middleware.BodyLimitConfig{
+		Skipper: isImport,
+		Limit:   viper.GetString("request.body.limit"),
+	}
+}
+
+func isImport(c echo.Context) bool {
+	return strings.HasSuffix(c.Path(), "/import")
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// setReady records whether the database is reachable, logging changes.
+func (s *server) setReady(ready bool) {
+	if s.ready.Swap(ready) == ready {
+		return
+	}
+	if ready {
+		log.Info("[API] Database reachable, leaving read-only mode")
+	} else {
+		log.Warn("[API] Database unreachable, entering read-only mode")
+	}
+}
+
+// monitorDB pings the database after each configured interval until ctx is
+// done, updating the readiness. Migrations skipped because the database was
+// unreachable on startup are applied once it answers.
+func (s *server) monitorDB(ctx context.Context) {
+	interval := viper.GetDuration("db.ping.interval") * time.Second
+	if interval <= 0 {
+		return
+	}
+	s.jobs.start("database-monitor", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		err := s.db.WithContext(ctx).Ping()
+		if err != nil {
+			log.Debugf("[API] Database ping: %v", err)
+		}
+		s.setReady(err == nil)
+		if err == nil && s.pendingMigrations.Load() {
+			if _, err := s.db.WithContext(ctx).Migrate(); err != nil {
+				log.Errorf("[API] Error on migrate: %v", err)
+				s.jobs.done("database-monitor", err)
+				continue
+			}
+			s.pendingMigrations.Store(false)
+		}
+		s.jobs.done("database-monitor", nil)
+	}
+}
+
+// readOnly rejects requests that change data while the database is
+// unreachable, rather than letting them fail halfway.
+func (s *server) readOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+		if !s.ready.Load() {
+			errMsg := "Database unavailable, the API is read-only"
+			return c.JSON(http.StatusServiceUnavailable, errorMessage(errMsg))
+		}
+		return next(c)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mfinancecombr/finance-wallet-api/db"
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+)
+
+// Behaviors accepted by the "onDelete" query parameter when removing a
+// broker or portfolio that is still referenced by operations.
+const (
+	onDeleteBlock    = "block"
+	onDeleteCascade  = "cascade"
+	onDeleteReassign = "reassign"
+)
+
+type referenceError struct {
+	status  int
+	message string
+}
+
+func (e *referenceError) Error() string {
+	return e.message
+}
+
+func returnReferenceError(c echo.Context, err error) error {
+	if refErr, ok := err.(*referenceError); ok {
+		return c.JSON(refErr.status, errorMessage(refErr.message))
+	}
+	return logAndReturnError(c, err.Error())
+}
+
+// returnWriteError reports unique index violations, such as a slug taken by
+// a concurrent request, as conflicts.
+func returnWriteError(c echo.Context, errMsg string, err error) error {
+	if errors.Is(err, db.ErrDuplicateKey) {
+		return c.JSON(http.StatusConflict, errorMessage(errMsg))
+	}
+	return logAndReturnError(c, errMsg)
+}
+
+type operationReferences interface {
+	GetBrokerSlug() string
+	GetPortfolioSlug() string
+	SetReferences(brokerSlug, portfolioSlug string)
+}
+
+// checkOperationReferences makes sure the broker and portfolio referenced by
+// an operation exist, replacing slugs given as aliases by the current ones so
+// operations are never saved with a stale slug.
+func (s *server) checkOperationReferences(c echo.Context, d operationReferences) error {
+	broker := &wallet.Broker{}
+	if err := s.requestDB(c).GetBySlug(d.GetBrokerSlug(), broker); err != nil {
+		return fmt.Errorf("Error on retrieve broker '%s': %v", d.GetBrokerSlug(), err)
+	}
+	if broker.Name == "" {
+		return &referenceError{
+			status:  http.StatusUnprocessableEntity,
+			message: fmt.Sprintf("Broker '%s' not found", d.GetBrokerSlug()),
+		}
+	}
+
+	portfolio := &wallet.Portfolio{}
+	if err := s.requestDB(c).GetBySlug(d.GetPortfolioSlug(), portfolio); err != nil {
+		return fmt.Errorf("Error on retrieve portfolio '%s': %v", d.GetPortfolioSlug(), err)
+	}
+	if portfolio.Name == "" {
+		return &referenceError{
+			status:  http.StatusUnprocessableEntity,
+			message: fmt.Sprintf("Portfolio '%s' not found", d.GetPortfolioSlug()),
+		}
+	}
+
+	d.SetReferences(broker.Slug, portfolio.Slug)
+	return nil
+}
+
+// deleteReferenced moves the document identified by id to the trash after
+// releasing the operations referencing its slug through field, as selected
+// by the "onDelete" query parameter. Both run in a single transaction, so
+// the operations are left untouched when the document cannot be deleted.
+func (s *server) deleteReferenced(c echo.Context, collectionName, id, field, slug string, target wallet.Sluggable) (*db.DeleteResult, error) {
+	var result *db.DeleteResult
+	err := s.auditedDB(c).Transaction(func(session db.DB) error {
+		if err := releaseReferences(c, session, id, field, slug, target); err != nil {
+			return err
+		}
+		var err error
+		if result, err = session.Delete(collectionName, id); err != nil {
+			return fmt.Errorf("Error on delete '%s': %v", id, err)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// releaseReferences handles the operations referencing slug through field
+// before the document identified by id is deleted. The behavior is selected
+// by the "onDelete" query parameter: "block" (default) refuses to delete
+// while there are operations, "cascade" deletes them and "reassign" moves
+// them to the document whose slug or alias is given by the "reassignTo"
+// query parameter.
+func releaseReferences(c echo.Context, session db.DB, id, field, slug string, target wallet.Sluggable) error {
+	count, err := session.CountOperationsByReference(field, slug)
+	if err != nil {
+		return fmt.Errorf("Error on count operations referencing '%s': %v", slug, err)
+	}
+	if count == 0 {
+		return nil
+	}
+
+	onDelete := c.QueryParam("onDelete")
+	logger(c).Debugf("[API] %d operations reference '%s', onDelete=%s", count, slug, onDelete)
+
+	switch onDelete {
+	case "", onDeleteBlock:
+		return &referenceError{
+			status:  http.StatusConflict,
+			message: fmt.Sprintf("'%s' is referenced by %d operations", slug, count),
+		}
+	case onDeleteCascade:
+		if _, err := session.DeleteOperationsByReference(field, slug); err != nil {
+			return fmt.Errorf("Error on delete operations referencing '%s': %v", slug, err)
+		}
+		return nil
+	case onDeleteReassign:
+		reassignTo := c.QueryParam("reassignTo")
+		if reassignTo == "" {
+			return &referenceError{
+				status:  http.StatusUnprocessableEntity,
+				message: "A different 'reassignTo' slug is required to reassign operations",
+			}
+		}
+		if err := session.GetBySlug(reassignTo, target); err != nil {
+			return fmt.Errorf("Error on retrieve '%s': %v", reassignTo, err)
+		}
+		if target.GetSlug() == "" {
+			return &referenceError{
+				status:  http.StatusUnprocessableEntity,
+				message: fmt.Sprintf("'%s' not found", reassignTo),
+			}
+		}
+		// reassignTo may be an alias, of the deleted document too.
+		if target.GetID() == id {
+			return &referenceError{
+				status:  http.StatusUnprocessableEntity,
+				message: "A different 'reassignTo' slug is required to reassign operations",
+			}
+		}
+		if _, err := session.ReassignOperations(field, slug, target.GetSlug()); err != nil {
+			return fmt.Errorf("Error on reassign operations from '%s' to '%s': %v", slug, target.GetSlug(), err)
+		}
+		return nil
+	default:
+		return &referenceError{
+			status:  http.StatusUnprocessableEntity,
+			message: fmt.Sprintf("Invalid onDelete value '%s'", onDelete),
+		}
+	}
+}
+
+// checkSlugAvailable makes sure slug is not used, as current slug or as an
+// alias, by a document other than the one identified by id.
+func (s *server) checkSlugAvailable(c echo.Context, slug, id string, d wallet.Sluggable) error {
+	if err := s.requestDB(c).GetBySlug(slug, d); err != nil {
+		return fmt.Errorf("Error on retrieve '%s': %v", slug, err)
+	}
+	if d.GetSlug() != "" && d.GetID() != id {
+		return &referenceError{
+			status:  http.StatusConflict,
+			message: fmt.Sprintf("Slug '%s' already in use", slug),
+		}
+	}
+	return nil
+}
+
+// checkSlugsAvailable runs checkSlugAvailable for each of slugs, such as the
+// slug and aliases of a document being restored, so each slug keeps
+// resolving to a single document.
+func (s *server) checkSlugsAvailable(c echo.Context, slugs []string, id string, newDocument func() wallet.Sluggable) error {
+	for _, slug := range slugs {
+		if err := s.checkSlugAvailable(c, slug, id, newDocument()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameAliases returns the aliases of a document renamed from "from" to
+// "to", so the old slug keeps resolving through GetBySlug.
+func renameAliases(aliases []string, from, to string) []string {
+	result := []string{from}
+	for _, alias := range aliases {
+		if alias != from && alias != to {
+			result = append(result, alias)
+		}
+	}
+	return result
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package api
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/mfinancecombr/finance-wallet-api/config"
+	"github.com/spf13/viper"
+)
+
+// Content security policies. The API only serves JSON, while the swagger UI
+// needs its inline scripts and styles.
+const (
+	apiPolicy       = "default-src 'none'; frame-ancestors 'none'"
+	swaggerUIPolicy = "default-src 'self'; script-src 'self' 'unsafe-inline'; " +
+		"style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'"
+)
+
+// corsConfig returns the cross-origin settings. Origins are checked on every
+// request, so they follow config reloads.
+func corsConfig() middleware.CORSConfig {
+	return middleware.CORSConfig{
+		AllowOriginFunc:  allowOrigin,
+		AllowMethods:     config.Methods(),
+		AllowCredentials: viper.GetBool("cors.credentials"),
+	}
+}
+
+// allowOrigin reports whether origin may make cross-origin requests.
+func allowOrigin(origin string) (bool, error) {
+	for _, allowed := range config.Origins() {
+		if allowed == "*" || allowed == origin {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// secureConfig returns the security headers of every response. HSTS is only
+// sent over HTTPS, including behind a proxy setting X-Forwarded-Proto.
+func secureConfig() middleware.SecureConfig {
+	return middleware.SecureConfig{
+		ContentSecurityPolicy: apiPolicy,
+		ContentTypeNosniff:    "nosniff",
+		HSTSMaxAge:            viper.GetInt("security.hsts.maxage"),
+		ReferrerPolicy:        "no-referrer",
+		XFrameOptions:         "DENY",
+		XSSProtection:         "1; mode=block",
+	}
+}
+
+// swaggerPolicy relaxes the content security policy for the swagger UI.
+func swaggerPolicy(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentSecurityPolicy, swaggerUIPolicy)
+		return next(c)
+	}
+}
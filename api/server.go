@@ -4,13 +4,25 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/mfinancecombr/finance-wallet-api/db"
 	_ "github.com/mfinancecombr/finance-wallet-api/docs" // docs is generated by Swag CLI
+	"github.com/mfinancecombr/finance-wallet-api/metrics"
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	echoSwagger "github.com/swaggo/echo-swagger"
 	"gopkg.in/go-playground/validator.v9"
@@ -26,11 +38,51 @@ type Server interface {
 type server struct {
 	*echo.Echo
 	db db.DB
+	// ready is set while the database is reachable.
+	ready atomic.Bool
+	// pendingMigrations is set when startup migrations could not run.
+	pendingMigrations atomic.Bool
+	started           time.Time
+	jobs              jobs
 }
 
+// Start serves the API until SIGINT or SIGTERM, then stops accepting
+// requests, waits for the in-flight ones and disconnects from the database.
 func (s *server) Start() {
 	addr := fmt.Sprintf(":%d", viper.GetInt("port"))
-	s.Echo.Logger.Fatal(s.Echo.Start(addr))
+	tlsConfig, err := tlsConfig()
+	if err != nil {
+		log.Fatalf("[API] Error on load TLS certificate: %v", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go s.purgeTrash(ctx)
+	go s.monitorDB(ctx)
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			s.Echo.TLSServer.Addr = addr
+			s.Echo.TLSServer.TLSConfig = tlsConfig
+			err = s.Echo.StartServer(s.Echo.TLSServer)
+		} else {
+			err = s.Echo.Start(addr)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			s.Echo.Logger.Fatal(err)
+		}
+	}()
+	<-ctx.Done()
+
+	log.Info("[API] Shutting down")
+	timeout := viper.GetDuration("shutdown.timeout") * time.Second
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.Echo.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("[API] Error on shut down: %v", err)
+	}
+	if err := s.db.Close(); err != nil {
+		log.Errorf("[API] Error on close database: %v", err)
+	}
 }
 
 type CustomValidator struct {
@@ -41,54 +93,116 @@ func (cv *CustomValidator) Validate(i interface{}) error {
 	return cv.validator.Struct(i)
 }
 
+// decimalValue lets validation tags such as "required" see decimals as
+// numbers, so a zero price or amount of shares is rejected.
+func decimalValue(field reflect.Value) interface{} {
+	if d, ok := field.Interface().(wallet.Decimal); ok {
+		return d.Float64()
+	}
+	return nil
+}
+
+// NewValidator returns the validator of request bodies.
+func NewValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterCustomTypeFunc(decimalValue, wallet.Decimal{})
+	return v
+}
+
+// NewServerFromDB returns the API server backed by the configured
+// database. When the database cannot be reached the server starts in
+// read-only mode and becomes ready once it answers.
 func NewServerFromDB() (Server, error) {
-	echoInstance := echo.New()
-	echoInstance.HideBanner = true
-	dbInstance, err := db.NewMongoSession()
+	dbInstance, err := db.New()
+	if errors.Is(err, db.ErrUnavailable) {
+		log.Errorf("[API] %v, starting in read-only mode", err)
+		s := NewServer(dbInstance).(*server)
+		s.ready.Store(false)
+		s.pendingMigrations.Store(viper.GetBool("db.migrate"))
+		return s, nil
+	}
 	if err != nil {
 		return nil, err
 	}
+	return NewServer(dbInstance), nil
+}
 
-	server := &server{
-		Echo: echoInstance,
-		db:   dbInstance,
+// NewServer returns the API server backed by database.
+func NewServer(database db.DB) Server {
+	echoInstance := echo.New()
+	echoInstance.HideBanner = true
+	// Client addresses are only taken from X-Forwarded-For behind a trusted
+	// proxy, so they cannot be forged to dodge rate limits.
+	echoInstance.IPExtractor = echo.ExtractIPDirect()
+	if viper.GetBool("proxy.trusted") {
+		echoInstance.IPExtractor = echo.ExtractIPFromXFFHeader()
 	}
 
+	server := &server{
+		Echo:    echoInstance,
+		db:      database,
+		started: time.Now(),
+	}
+	server.ready.Store(true)
+
+	accessLogFormat := "timestamp=${time_rfc3339} " +
+		"method=${method} " +
+		"request_uri=${uri} " +
+		"status=${status} " +
+		"request_id=${id} " +
+		"latency=${latency_human}\n"
+	if viper.GetString("log.format") == "json" {
+		accessLogFormat = `{"timestamp":"${time_rfc3339}",` +
+			`"method":"${method}",` +
+			`"request_uri":"${uri}",` +
+			`"status":${status},` +
+			`"request_id":"${id}",` +
+			`"latency":"${latency_human}"}` + "\n"
+	}
+	echoInstance.Use(middleware.RequestID())
 	echoInstance.Use(
 		middleware.LoggerWithConfig(
-			middleware.LoggerConfig{
-				Format: "timestamp=${time_rfc3339} " +
-					"method=${method} " +
-					"request_uri=${uri} " +
-					"status=${status} " +
-					"request_id=${id} " +
-					"latency=${latency_human}\n",
-			},
+			middleware.LoggerConfig{Format: accessLogFormat},
 		),
 	)
+	echoInstance.Use(measureRequests)
+	echoInstance.Use(traceRequests)
+	echoInstance.Use(correlateLogs)
 	echoInstance.Use(middleware.Recover())
-	// FIXME
-	echoInstance.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{
-			echo.GET, echo.OPTIONS, echo.POST, echo.DELETE, echo.PUT,
-		},
-	}))
+	// CORS and security headers come first, so refused requests, such as
+	// those over the rate limit or in read-only mode, carry them too.
+	echoInstance.Use(middleware.CORSWithConfig(corsConfig()))
+	echoInstance.Use(middleware.SecureWithConfig(secureConfig()))
+	echoInstance.Use(rateLimit())
+	echoInstance.Use(middleware.BodyLimitWithConfig(bodyLimitConfig()))
+	echoInstance.Use(server.readOnly)
 	echoInstance.Pre(middleware.RemoveTrailingSlash())
 
-	echoInstance.Validator = &CustomValidator{validator: validator.New()}
+	echoInstance.Validator = &CustomValidator{validator: NewValidator()}
 
 	echoInstance.File("/favicon.ico", "images/favicon.ico")
 	echoInstance.GET("/", server.index)
 	echoInstance.GET("/healthcheck", server.healthcheck)
-	echoInstance.GET("/swagger/*", echoSwagger.WrapHandler)
+	echoInstance.GET("/livez", server.livez)
+	echoInstance.GET("/readyz", server.readyz)
+	registry := metrics.NewRegistry(&walletCollector{db: database})
+	echoInstance.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+	echoInstance.GET("/swagger/*", echoSwagger.WrapHandler, swaggerPolicy)
 	echoInstance.Static("/static/icons", "images/icons")
 
 	echoInstance.GET("/api/v1/operations", server.getAllOperations)
 	echoInstance.DELETE("/api/v1/operations/:id", server.deleteOperationByID)
+	echoInstance.GET("/api/v1/operations/:id/history", server.getOperationHistory)
+	echoInstance.GET("/api/v1/history", server.getAuditFeed)
+
+	echoInstance.GET("/api/v1/trash", server.getTrash)
+	echoInstance.POST("/api/v1/trash/:collection/:id/restore", server.restoreFromTrash)
 	echoInstance.GET("/api/v1/purchases", server.getAllPurchases)
 	echoInstance.GET("/api/v1/sales", server.getAllSales)
 
+	echoInstance.POST("/api/v1/prices/import", server.importPrices, middleware.BodyLimit(viper.GetString("request.import.limit")))
+	echoInstance.GET("/api/v1/prices/:itemType/:symbol", server.getPrices)
+
 	echoInstance.DELETE("/api/v1/brokers/:id", server.brokersDelete)
 	echoInstance.GET("/api/v1/brokers", server.brokers)
 	echoInstance.GET("/api/v1/brokers/:id", server.broker)
@@ -125,5 +239,5 @@ func NewServerFromDB() (Server, error) {
 	echoInstance.POST("/api/v1/ficfi/operations", server.insertFICFIOperation)
 	echoInstance.PUT("/api/v1/ficfi/operations/:id", server.updateFICFIOperationByID)
 
-	return server, nil
+	return server
 }
@@ -9,12 +9,11 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/mfinancecombr/finance-wallet-api/wallet"
-	log "github.com/sirupsen/logrus"
 )
 
 func (s *server) getAllStockFundsOperations(c echo.Context) error {
-	log.Debug("[API] Retrieving all stocks funds operations")
-	result, err := s.db.GetAll(wallet.StockFund{})
+	logger(c).Debug("[API] Retrieving all stocks funds operations")
+	result, err := s.requestDB(c).GetAll(wallet.StockFund{})
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on retrieve stocks funds operations: %v", err)
 		return logAndReturnError(c, errMsg)
@@ -34,9 +33,9 @@ func (s *server) getAllStockFundsOperations(c echo.Context) error {
 // @Param id path string true "Operation id"
 func (s *server) getStockFundOperationByID(c echo.Context) error {
 	id := c.Param("id")
-	log.Debugf("[API] Retrieving stock fund operation with id: %s", id)
+	logger(c).Debugf("[API] Retrieving stock fund operation with id: %s", id)
 	result := &wallet.StockFund{}
-	if err := s.db.Get(id, result); err != nil {
+	if err := s.requestDB(c).Get(id, result); err != nil {
 		errMsg := fmt.Sprintf("Error on retrieve '%s' operations: %v", id, err)
 		return logAndReturnError(c, errMsg)
 	}
@@ -57,7 +56,7 @@ func (s *server) getStockFundOperationByID(c echo.Context) error {
 // @Failure 500 {object} api.ErrorMessage
 // @Router /stocks-funds/operations [post]
 func (s *server) insertStockFundOperation(c echo.Context) error {
-	log.Debugf("[API] Inserting stock fund operation")
+	logger(c).Debugf("[API] Inserting stock fund operation")
 
 	data := wallet.NewStockFund()
 
@@ -71,7 +70,11 @@ func (s *server) insertStockFundOperation(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
 	}
 
-	result, err := s.db.Create(data)
+	if err := s.checkOperationReferences(c, data); err != nil {
+		return returnReferenceError(c, err)
+	}
+
+	result, err := s.auditedDB(c).Create(data)
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on insert stock fund: %v", err)
 		return logAndReturnError(c, errMsg)
@@ -93,7 +96,7 @@ func (s *server) insertStockFundOperation(c echo.Context) error {
 // @Param id path string true "Operation id"
 func (s *server) updateStockFundOperationByID(c echo.Context) error {
 	id := c.Param("id")
-	log.Debugf("[API] Updating stock fund operation with id %s", id)
+	logger(c).Debugf("[API] Updating stock fund operation with id %s", id)
 
 	data := wallet.NewStockFund()
 
@@ -107,7 +110,11 @@ func (s *server) updateStockFundOperationByID(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
 	}
 
-	result, err := s.db.Update(id, data)
+	if err := s.checkOperationReferences(c, data); err != nil {
+		return returnReferenceError(c, err)
+	}
+
+	result, err := s.auditedDB(c).Update(id, data)
 	if err != nil {
 		errMsg := fmt.Sprintf("Error on update stock fund: %v", err)
 		return logAndReturnError(c, errMsg)
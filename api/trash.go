@@ -0,0 +1,183 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mfinancecombr/finance-wallet-api/db"
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+type trashedOperation struct {
+	BrokerSlug    string `bson:"brokerSlug"`
+	PortfolioSlug string `bson:"portfolioSlug"`
+}
+
+func (o trashedOperation) GetBrokerSlug() string {
+	return o.BrokerSlug
+}
+
+func (o trashedOperation) GetPortfolioSlug() string {
+	return o.PortfolioSlug
+}
+
+func (o *trashedOperation) SetReferences(brokerSlug, portfolioSlug string) {
+	o.BrokerSlug = brokerSlug
+	o.PortfolioSlug = portfolioSlug
+}
+
+// trashedSluggable holds the slugs of a deleted broker or portfolio.
+type trashedSluggable struct {
+	Aliases []string `bson:"aliases"`
+	ID      string   `bson:"_id"`
+	Slug    string   `bson:"slug"`
+}
+
+func isTrashCollection(collectionName string) bool {
+	for _, c := range db.TrashCollections {
+		if c == collectionName {
+			return true
+		}
+	}
+	return false
+}
+
+// getTrash godoc
+// @Summary List the trash
+// @Description get all deleted brokers, portfolios and operations
+// @Accept json
+// @Produce json
+// @Success 200 {object} interface{}
+// @Failure 500 {object} api.ErrorMessage
+// @Router /trash [get]
+func (s *server) getTrash(c echo.Context) error {
+	logger(c).Debug("[API] Retrieving trash")
+	result, err := s.requestDB(c).GetTrash()
+	if err != nil {
+		errMsg := fmt.Sprintf("Error on retrieve trash: %v", err)
+		return logAndReturnError(c, errMsg)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// restoreFromTrash godoc
+// @Summary Restore from the trash
+// @Description restore some deleted broker, portfolio or operation
+// @Accept json
+// @Produce json
+// @Success 200 {object} interface{}
+// @Failure 404 {object} api.ErrorMessage
+// @Failure 422 {object} api.ErrorMessage
+// @Failure 500 {object} api.ErrorMessage
+// @Router /trash/{collection}/{id}/restore [post]
+// @Param collection path string true "brokers, portfolios or operations"
+// @Param id path string true "Document id"
+func (s *server) restoreFromTrash(c echo.Context) error {
+	collectionName := c.Param("collection")
+	id := c.Param("id")
+	logger(c).Debugf("[API] Restoring %s '%s'", collectionName, id)
+
+	if !isTrashCollection(collectionName) {
+		errMsg := fmt.Sprintf("Invalid collection '%s'", collectionName)
+		return c.JSON(http.StatusUnprocessableEntity, errorMessage(errMsg))
+	}
+
+	var stored, current trashedOperation
+	switch collectionName {
+	case "operations":
+		operation := &trashedOperation{}
+		if err := s.requestDB(c).GetTrashed(collectionName, id, operation); err != nil {
+			errMsg := fmt.Sprintf("Error on retrieve operation '%s': %v", id, err)
+			return logAndReturnError(c, errMsg)
+		}
+		if operation.BrokerSlug != "" || operation.PortfolioSlug != "" {
+			stored = *operation
+			if err := s.checkOperationReferences(c, operation); err != nil {
+				return returnReferenceError(c, err)
+			}
+			current = *operation
+		}
+	case "brokers", "portfolios":
+		doc := &trashedSluggable{}
+		if err := s.requestDB(c).GetTrashed(collectionName, id, doc); err != nil {
+			errMsg := fmt.Sprintf("Error on retrieve '%s': %v", id, err)
+			return logAndReturnError(c, errMsg)
+		}
+		newDocument := func() wallet.Sluggable { return &wallet.Broker{} }
+		if collectionName == "portfolios" {
+			newDocument = func() wallet.Sluggable { return &wallet.Portfolio{} }
+		}
+		slugs := append([]string{doc.Slug}, doc.Aliases...)
+		if err := s.checkSlugsAvailable(c, slugs, doc.ID, newDocument); err != nil {
+			return returnReferenceError(c, err)
+		}
+	}
+
+	result, err := s.auditedDB(c).Restore(collectionName, id)
+	if err != nil {
+		errMsg := fmt.Sprintf("Error on restore '%s': %v", id, err)
+		return returnWriteError(c, errMsg, err)
+	}
+
+	if result.ModifiedCount == 0 {
+		errMsg := fmt.Sprintf("'%s' not found in %s trash", id, collectionName)
+		return c.JSON(http.StatusNotFound, errorMessage(errMsg))
+	}
+
+	// References renamed while the operation was in the trash are moved to
+	// the current slugs.
+	references := []struct{ field, from, to string }{
+		{db.BrokerSlugField, stored.BrokerSlug, current.BrokerSlug},
+		{db.PortfolioSlugField, stored.PortfolioSlug, current.PortfolioSlug},
+	}
+	for _, r := range references {
+		if r.from == r.to {
+			continue
+		}
+		if _, err := s.auditedDB(c).ReassignOperations(r.field, r.from, r.to); err != nil {
+			errMsg := fmt.Sprintf("Error on reassign operations from '%s' to '%s': %v", r.from, r.to, err)
+			return logAndReturnError(c, errMsg)
+		}
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// purgeTrash permanently removes documents kept in the trash longer than the
+// configured retention, checking again after each interval until ctx is
+// done.
+func (s *server) purgeTrash(ctx context.Context) {
+	retention := time.Duration(viper.GetInt("trash.retention.days")) * 24 * time.Hour
+	interval := viper.GetDuration("trash.purge.interval") * time.Hour
+	if interval <= 0 {
+		log.Info("[API] Trash purge disabled")
+		return
+	}
+	s.jobs.start("trash-purge", interval)
+	for {
+		// The trash is purged on the next interval while in read-only mode.
+		if s.ready.Load() {
+			before := time.Now().UTC().Add(-retention)
+			purged, err := s.db.WithContext(ctx).WithActor("trash-purge").PurgeTrash(before)
+			s.jobs.done("trash-purge", err)
+			if err != nil {
+				log.Errorf("[API] Error on purge trash: %v", err)
+			} else if purged > 0 {
+				log.Infof("[API] Purged %d documents from the trash", purged)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
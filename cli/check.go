@@ -0,0 +1,100 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mfinancecombr/finance-wallet-api/api"
+	"github.com/mfinancecombr/finance-wallet-api/db"
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	log "github.com/sirupsen/logrus"
+)
+
+func check(args []string) error {
+	if err := parseFlags(newFlagSet("check"), args, 0); err != nil {
+		return err
+	}
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	problems, err := Check(database)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stdout, problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %d", ErrProblems, len(problems))
+	}
+	log.Info("No problems found")
+	return nil
+}
+
+// Check looks for inconsistencies in database: pending migrations, invalid
+// operations, operations referencing missing brokers or portfolios or
+// referencing them by an old slug, and positions not matching their
+// operations.
+func Check(database db.DB) ([]string, error) {
+	problems := []string{}
+	pending, err := database.PendingMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("error on retrieve migrations: %v", err)
+	}
+	if pending > 0 {
+		problems = append(problems, fmt.Sprintf("%d pending migrations, run migrate", pending))
+	}
+
+	brokers, err := currentSlugs(database, wallet.Broker{})
+	if err != nil {
+		return nil, err
+	}
+	portfolios, err := currentSlugs(database, wallet.Portfolio{})
+	if err != nil {
+		return nil, err
+	}
+	validate := api.NewValidator()
+	for _, itemType := range wallet.ItemTypes {
+		operations, err := database.GetAll(wallet.NewOperation(itemType).(wallet.Queryable))
+		if err != nil {
+			return nil, fmt.Errorf("error on retrieve %s operations: %v", itemType, err)
+		}
+		for _, operation := range operations {
+			tradable := operation.(wallet.Tradable)
+			id := tradable.GetID()
+			if err := validate.Struct(operation); err != nil {
+				problems = append(problems, fmt.Sprintf("operation %s is invalid: %v", id, err))
+			}
+			problems = append(problems, referenceProblems(id, "broker", tradable.GetBrokerSlug(), brokers)...)
+			problems = append(problems, referenceProblems(id, "portfolio", tradable.GetPortfolioSlug(), portfolios)...)
+		}
+	}
+
+	drifted, err := database.CheckPositions()
+	if err != nil {
+		return nil, fmt.Errorf("error on check positions: %v", err)
+	}
+	for _, id := range drifted {
+		problems = append(problems, fmt.Sprintf("position %s does not match its operations, run recalc-positions", id))
+	}
+	return problems, nil
+}
+
+// referenceProblems reports an operation referencing a missing broker or
+// portfolio, or one whose slug changed: the operation is then left out of
+// the positions of the current slug.
+func referenceProblems(id, kind, slug string, slugs map[string]string) []string {
+	current, ok := slugs[slug]
+	if !ok {
+		return []string{fmt.Sprintf("operation %s references missing %s '%s'", id, kind, slug)}
+	}
+	if current != slug {
+		return []string{fmt.Sprintf("operation %s references %s '%s' by its old slug '%s'", id, kind, current, slug)}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+// Package cli implements the commands of the finance-wallet-api binary.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mfinancecombr/finance-wallet-api/config"
+	"github.com/mfinancecombr/finance-wallet-api/db"
+)
+
+// actor identifies the changes made by commands in the history.
+const actor = "cli"
+
+type command struct {
+	name    string
+	aliases []string
+	args    string
+	summary string
+	run     func(args []string) error
+}
+
+func commands() []command {
+	return []command{
+		{name: "serve", summary: "start the HTTP API (default)", run: serve},
+		{name: "migrate", summary: "apply the pending database migrations", run: migrate},
+		{name: "import", args: "[flags] FILE", summary: "import brokers, portfolios and operations, or prices", run: importCommand},
+		{name: "export", args: "[flags]", summary: "export brokers, portfolios and operations", run: exportCommand},
+		{name: "recalc-positions", aliases: []string{"rebuild-positions"}, summary: "recompute the positions from the operations", run: recalcPositions},
+		{name: "backfill-prices", summary: "store the missing daily prices of every symbol", run: backfillPrices},
+		{name: "check", summary: "check the consistency of the stored data", run: check},
+		{name: "user", args: "[flags] [list | history NAME]", summary: "list the users with changes in the history, or the changes of one", run: user},
+		{name: "config", summary: "print the effective configuration", run: printConfig},
+	}
+}
+
+// Run parses the global flags and runs the command named by args, serving
+// the API when none is given.
+func Run(args []string) error {
+	flags := flag.NewFlagSet("finance-wallet-api", flag.ContinueOnError)
+	configPath := flags.String("config", "", "YAML, TOML or JSON config file")
+	flags.Usage = func() { usage(flags.Output(), flags) }
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := config.Load(*configPath); err != nil {
+		return err
+	}
+
+	name, rest := "serve", []string{}
+	if flags.NArg() > 0 {
+		name, rest = flags.Arg(0), flags.Args()[1:]
+	}
+	for _, c := range commands() {
+		if c.name == name || contains(c.aliases, name) {
+			return c.run(rest)
+		}
+	}
+	flags.Usage()
+	return fmt.Errorf("unknown command '%s'", name)
+}
+
+func usage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: finance-wallet-api [-config FILE] [COMMAND]\n\nCommands:\n")
+	for _, c := range commands() {
+		fmt.Fprintf(w, "  %-18s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nFlags:\n")
+	flags.PrintDefaults()
+	fmt.Fprintf(w, "\nRun 'finance-wallet-api COMMAND -h' for the flags of a command.\n")
+}
+
+// newFlagSet returns the flag set of the command named name.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		for _, c := range commands() {
+			if c.name == name {
+				fmt.Fprintf(flags.Output(), "Usage: finance-wallet-api %s %s\n\n%s.\n\n", name, c.args, strings.ToUpper(c.summary[:1])+c.summary[1:])
+			}
+		}
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses the flags of a command, which may also take up to
+// maxArgs arguments.
+func parseFlags(flags *flag.FlagSet, args []string, maxArgs int) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > maxArgs {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args()[maxArgs:], " "))
+	}
+	return nil
+}
+
+// openDB connects to the configured database, recording changes as made by
+// the command line.
+func openDB() (db.DB, error) {
+	database, err := db.New()
+	if err != nil {
+		return nil, err
+	}
+	return database.WithActor(actor), nil
+}
+
+// ErrProblems is returned by commands which found problems in the data, so
+// scripts can tell them from failures by the exit status.
+var ErrProblems = errors.New("problems found")
+
+func printConfig(args []string) error {
+	if err := parseFlags(newFlagSet("config"), args, 0); err != nil {
+		return err
+	}
+	return config.Print(os.Stdout)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
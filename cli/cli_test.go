@@ -0,0 +1,175 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/db"
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+)
+
+const dump = `{
+  "brokers": [{"name": "Easynvest", "slug": "easynvest"}],
+  "portfolios": [{"name": "Default", "slug": "default"}],
+  "operations": [
+    {"id": "5e9b1ee0e4b0a1f2c3d4e5f6", "itemType": "stocks", "symbol": "PETR4", "date": "2020-01-02T00:00:00Z",
+     "type": "purchase", "shares": 100, "price": "29.90", "commission": 10,
+     "brokerSlug": "easynvest", "portfolioSlug": "default"}
+  ]
+}`
+
+func TestImportExport(t *testing.T) {
+	database := db.NewMemorySession()
+
+	result, err := Import(database, strings.NewReader(dump), formatJSON, true)
+	if err != nil || result.Brokers != 1 || result.Operations != 1 {
+		t.Fatalf("unexpected dry run %+v (%v)", result, err)
+	}
+	if count, _ := database.Count("operations"); count != 0 {
+		t.Fatalf("expected a dry run not to write, got %d operations", count)
+	}
+	if _, err := Import(database, strings.NewReader(dump), formatJSON, false); err != nil {
+		t.Fatal(err)
+	}
+
+	operations := "itemType,symbol,date,type,shares,price,brokerSlug,portfolioSlug\n" +
+		"fiis,HGLG11,2020-01-03,purchase,10,170.5,easynvest,default\n"
+	result, err = Import(database, strings.NewReader(operations), formatCSV, false)
+	if err != nil || result.Operations != 1 {
+		t.Fatalf("unexpected CSV import %+v (%v)", result, err)
+	}
+	missing := strings.Replace(operations, "easynvest", "clear", 1)
+	if _, err := Import(database, strings.NewReader(missing), formatCSV, false); err == nil || !strings.Contains(err.Error(), "broker 'clear' not found") {
+		t.Fatalf("expected the missing broker to be reported, got %v", err)
+	}
+
+	var output bytes.Buffer
+	if err := Export(database, &output, formatJSON); err != nil {
+		t.Fatal(err)
+	}
+	exported := Dump{}
+	if err := json.Unmarshal(output.Bytes(), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported.Brokers) != 1 || len(exported.Portfolios) != 1 || len(exported.Operations) != 2 {
+		t.Fatalf("unexpected export %s", output.String())
+	}
+
+	// Importing the export again skips everything.
+	result, err = Import(database, bytes.NewReader(output.Bytes()), formatJSON, false)
+	if err != nil || result.Skipped != 4 || result.Operations != 0 {
+		t.Fatalf("unexpected import of the export %+v (%v)", result, err)
+	}
+
+	output.Reset()
+	if err := Export(database, &output, formatCSV); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "stocks,PETR4,2020-01-02T00:00:00Z,purchase,100,29.9,10,easynvest,default") {
+		t.Fatalf("unexpected CSV export %s", output.String())
+	}
+}
+
+func TestImportOldSlug(t *testing.T) {
+	database := db.NewMemorySession()
+	if _, err := Import(database, strings.NewReader(dump), formatJSON, false); err != nil {
+		t.Fatal(err)
+	}
+	portfolio := &wallet.Portfolio{}
+	if err := database.GetBySlug("default", portfolio); err != nil {
+		t.Fatal(err)
+	}
+	renamed := &wallet.Portfolio{Aliases: []string{"default"}, Name: "Default", Slug: "renamed"}
+	if _, err := database.Rename(portfolio.ID, renamed, db.PortfolioSlugField, "default", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+
+	operations := "itemType,symbol,date,type,shares,price,brokerSlug,portfolioSlug\n" +
+		"fiis,HGLG11,2020-01-03,purchase,10,170.5,easynvest,default\n"
+	if _, err := Import(database, strings.NewReader(operations), formatCSV, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.GetPortfolioData(renamed, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(renamed.Items[wallet.FIIItemType]) != 1 {
+		t.Fatalf("expected the operation imported into the renamed portfolio, got %+v", renamed.Items)
+	}
+	problems, err := Check(database)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v (%v)", problems, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	database := db.NewMemorySession()
+	if _, err := Import(database, strings.NewReader(dump), formatJSON, false); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := Check(database)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v (%v)", problems, err)
+	}
+
+	date := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	operation := &wallet.FII{
+		BrokerSlug: "easynvest", Date: &date, ItemType: wallet.FIIItemType, PortfolioSlug: "retirement",
+		Price: wallet.NewDecimalFromInt(170), Shares: wallet.NewDecimalFromInt(10), Symbol: "HGLG11", Type: "purchase",
+	}
+	if _, err := database.Create(operation); err != nil {
+		t.Fatal(err)
+	}
+	problems, err = Check(database)
+	if err != nil || len(problems) != 1 || !strings.Contains(problems[0], "missing portfolio 'retirement'") {
+		t.Fatalf("expected the missing portfolio to be reported, got %v (%v)", problems, err)
+	}
+
+	broker := &wallet.Broker{}
+	if err := database.GetBySlug("easynvest", broker); err != nil {
+		t.Fatal(err)
+	}
+	broker.Aliases, broker.Slug = []string{"easynvest"}, "nuinvest"
+	if _, err := database.Update(broker.ID, broker); err != nil {
+		t.Fatal(err)
+	}
+	problems, err = Check(database)
+	if err != nil || len(problems) != 3 || !strings.Contains(problems[0], "by its old slug 'easynvest'") {
+		t.Fatalf("expected the old slugs to be reported, got %v (%v)", problems, err)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	database := db.NewMemorySession()
+	if _, err := database.WithActor("alice").Create(&wallet.Broker{Name: "Easynvest", Slug: "easynvest"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, slug := range []string{"default", "retirement"} {
+		if _, err := database.WithActor("bob").Create(&wallet.Portfolio{Name: slug, Slug: slug}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var output bytes.Buffer
+	if err := ListUsers(database, &output); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 || strings.Fields(lines[1])[0] != "alice" || strings.Fields(lines[2])[1] != "2" {
+		t.Fatalf("unexpected users %q", output.String())
+	}
+
+	output.Reset()
+	if err := UserHistory(database, &output, "bob", 1); err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "create") || !strings.Contains(lines[1], "portfolios") {
+		t.Fatalf("unexpected history %q", output.String())
+	}
+}
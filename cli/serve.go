@@ -0,0 +1,94 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/api"
+	"github.com/mfinancecombr/finance-wallet-api/config"
+	"github.com/mfinancecombr/finance-wallet-api/tracing"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func serve(args []string) error {
+	if err := parseFlags(newFlagSet("serve"), args, 0); err != nil {
+		return err
+	}
+	log.WithFields(config.Effective()).Info("[Config] Effective configuration")
+	shutdownTracing, err := tracing.Setup(api.Version)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Errorf("Error on flush spans: %v", err)
+		}
+	}()
+	server, err := api.NewServerFromDB()
+	if err != nil {
+		return err
+	}
+	server.Start()
+	return nil
+}
+
+// migrate applies the pending database migrations.
+func migrate(args []string) error {
+	if err := parseFlags(newFlagSet("migrate"), args, 0); err != nil {
+		return err
+	}
+	viper.Set("db.migrate", false)
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	count, err := database.Migrate()
+	if err != nil {
+		return err
+	}
+	log.Infof("Applied %d migrations", count)
+	return nil
+}
+
+// recalcPositions recomputes the materialized positions from the
+// operations, fixing any drift.
+func recalcPositions(args []string) error {
+	if err := parseFlags(newFlagSet("recalc-positions"), args, 0); err != nil {
+		return err
+	}
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	count, err := database.RebuildPositions()
+	if err != nil {
+		return err
+	}
+	log.Infof("Rebuilt %d positions", count)
+	return nil
+}
+
+// backfillPrices stores the prices missing since the first operation of
+// every symbol, retrieved from the market data providers.
+func backfillPrices(args []string) error {
+	if err := parseFlags(newFlagSet("backfill-prices"), args, 0); err != nil {
+		return err
+	}
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	count, err := database.BackfillPrices(time.Now())
+	if err != nil {
+		return err
+	}
+	log.Infof("Backfilled %d prices", count)
+	return nil
+}
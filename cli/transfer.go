@@ -0,0 +1,531 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/api"
+	"github.com/mfinancecombr/finance-wallet-api/db"
+	"github.com/mfinancecombr/finance-wallet-api/marketdata"
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	log "github.com/sirupsen/logrus"
+)
+
+// Formats of imported and exported files.
+const (
+	formatCSV  = "csv"
+	formatJSON = "json"
+)
+
+// operationColumns are the columns of operations in CSV files. Only
+// certificates of deposit and treasuries use the last two.
+var operationColumns = []string{
+	"itemType", "symbol", "date", "type", "shares", "price", "commission",
+	"brokerSlug", "portfolioSlug", "dueDate", "fixedInterestRate",
+}
+
+// Dump holds everything exported. Operations are decoded according to their
+// item type.
+type Dump struct {
+	Brokers    []wallet.Broker   `json:"brokers"`
+	Portfolios []portfolio       `json:"portfolios"`
+	Operations []json.RawMessage `json:"operations"`
+}
+
+// portfolio is a stored portfolio, without the computed positions.
+type portfolio struct {
+	Aliases []string `json:"aliases,omitempty"`
+	Name    string   `json:"name"`
+	Slug    string   `json:"slug"`
+}
+
+// ImportResult reports what an import wrote, or would write on a dry run.
+type ImportResult struct {
+	Brokers    int
+	Portfolios int
+	Operations int
+	Prices     int64
+	Skipped    int
+}
+
+func importCommand(args []string) error {
+	flags := newFlagSet("import")
+	format := flags.String("format", "", "csv or json, by default from the file extension")
+	prices := flags.Bool("prices", false, "import a price series instead, as accepted by POST /api/v1/prices/import")
+	dryRun := flags.Bool("dry-run", false, "only validate the file")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("missing file to import, or - for the standard input")
+	}
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = formatJSON
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			*format = formatCSV
+		}
+	}
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	var result ImportResult
+	if *prices {
+		result, err = ImportPrices(database, r, *format, *dryRun)
+	} else {
+		result, err = Import(database, r, *format, *dryRun)
+	}
+	if err != nil {
+		return err
+	}
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+	log.Infof("%s %d brokers, %d portfolios, %d operations and %d prices; skipped %d existing",
+		verb, result.Brokers, result.Portfolios, result.Operations, result.Prices, result.Skipped)
+	return nil
+}
+
+func exportCommand(args []string) error {
+	flags := newFlagSet("export")
+	format := flags.String("format", formatJSON, "json, with everything, or csv, with operations only")
+	output := flags.String("o", "-", "output file, or - for the standard output")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	w := io.Writer(os.Stdout)
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return Export(database, w, *format)
+}
+
+// Export writes the brokers, portfolios and operations of database as JSON,
+// or only the operations as CSV.
+func Export(database db.DB, w io.Writer, format string) error {
+	dump, err := getDump(database)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(dump)
+	case formatCSV:
+		return writeOperationsCSV(w, dump.Operations)
+	}
+	return fmt.Errorf("unknown format '%s'", format)
+}
+
+func getDump(database db.DB) (*Dump, error) {
+	dump := &Dump{Brokers: []wallet.Broker{}, Portfolios: []portfolio{}, Operations: []json.RawMessage{}}
+	brokers, err := database.GetAll(wallet.Broker{})
+	if err != nil {
+		return nil, fmt.Errorf("error on retrieve brokers: %v", err)
+	}
+	for _, b := range brokers {
+		broker := b.(wallet.Broker)
+		broker.ID = ""
+		dump.Brokers = append(dump.Brokers, broker)
+	}
+	portfolios, err := database.GetAll(wallet.Portfolio{})
+	if err != nil {
+		return nil, fmt.Errorf("error on retrieve portfolios: %v", err)
+	}
+	for _, p := range portfolios {
+		p := p.(wallet.Portfolio)
+		dump.Portfolios = append(dump.Portfolios, portfolio{Aliases: p.Aliases, Name: p.Name, Slug: p.Slug})
+	}
+	for _, itemType := range wallet.ItemTypes {
+		operations, err := database.GetAll(wallet.NewOperation(itemType).(wallet.Queryable))
+		if err != nil {
+			return nil, fmt.Errorf("error on retrieve %s operations: %v", itemType, err)
+		}
+		for _, operation := range operations {
+			raw, err := operationJSON(operation)
+			if err != nil {
+				return nil, err
+			}
+			dump.Operations = append(dump.Operations, raw)
+		}
+	}
+	return dump, nil
+}
+
+// operationJSON encodes an operation without its ID, which is given anew
+// when imported.
+func operationJSON(operation interface{}) (json.RawMessage, error) {
+	fields, err := operationFields(operation)
+	if err != nil {
+		return nil, err
+	}
+	delete(fields, "id")
+	return json.Marshal(fields)
+}
+
+func operationFields(operation interface{}) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(operation)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(raw, &fields)
+	return fields, err
+}
+
+func writeOperationsCSV(w io.Writer, operations []json.RawMessage) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(operationColumns); err != nil {
+		return err
+	}
+	for _, raw := range operations {
+		fields := map[string]interface{}{}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&fields); err != nil {
+			return err
+		}
+		row := make([]string, len(operationColumns))
+		for i, column := range operationColumns {
+			if value, ok := fields[column]; ok && value != nil {
+				row[i] = fmt.Sprint(value)
+			}
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// referencing operations have their references replaced by the current
+// slugs before being saved.
+type referencing interface {
+	wallet.Tradable
+	SetReferences(brokerSlug, portfolioSlug string)
+}
+
+// Import adds the brokers, portfolios and operations read from r, in the
+// JSON format written by Export or as CSV operations. Everything is
+// validated first and then written in a single transaction. Brokers and
+// portfolios whose slug already exists and operations equal to existing
+// ones are skipped, so importing a file again changes nothing. Operations
+// referencing a broker or portfolio by an old slug are saved with the
+// current one.
+func Import(database db.DB, r io.Reader, format string, dryRun bool) (ImportResult, error) {
+	result := ImportResult{}
+	dump := &Dump{}
+	switch format {
+	case formatJSON:
+		if err := json.NewDecoder(r).Decode(dump); err != nil {
+			return result, fmt.Errorf("error on read file: %v", err)
+		}
+	case formatCSV:
+		operations, err := readOperationsCSV(r)
+		if err != nil {
+			return result, err
+		}
+		dump.Operations = operations
+	default:
+		return result, fmt.Errorf("unknown format '%s'", format)
+	}
+
+	validate := api.NewValidator()
+	brokers, err := currentSlugs(database, wallet.Broker{})
+	if err != nil {
+		return result, err
+	}
+	portfolios, err := currentSlugs(database, wallet.Portfolio{})
+	if err != nil {
+		return result, err
+	}
+	existing, err := existingOperations(database)
+	if err != nil {
+		return result, err
+	}
+
+	newBrokers := []*wallet.Broker{}
+	for i, b := range dump.Brokers {
+		b := b
+		b.ID = ""
+		if err := validate.Struct(b); err != nil {
+			return result, fmt.Errorf("invalid broker %d: %v", i+1, err)
+		}
+		if _, ok := brokers[b.Slug]; ok {
+			result.Skipped++
+			continue
+		}
+		addSlugs(brokers, b.Slug, b.Aliases)
+		newBrokers = append(newBrokers, &b)
+	}
+	newPortfolios := []*wallet.Portfolio{}
+	for i, p := range dump.Portfolios {
+		p := &wallet.Portfolio{Aliases: p.Aliases, Name: p.Name, Slug: p.Slug}
+		if err := validate.Struct(p); err != nil {
+			return result, fmt.Errorf("invalid portfolio %d: %v", i+1, err)
+		}
+		if _, ok := portfolios[p.Slug]; ok {
+			result.Skipped++
+			continue
+		}
+		addSlugs(portfolios, p.Slug, p.Aliases)
+		newPortfolios = append(newPortfolios, p)
+	}
+	operations := []wallet.Tradable{}
+	for i, raw := range dump.Operations {
+		operation, err := decodeOperation(raw)
+		if err == nil {
+			err = validate.Struct(operation)
+		}
+		if err != nil {
+			return result, fmt.Errorf("invalid operation %d: %v", i+1, err)
+		}
+		broker, ok := brokers[operation.GetBrokerSlug()]
+		if !ok {
+			return result, fmt.Errorf("invalid operation %d: broker '%s' not found", i+1, operation.GetBrokerSlug())
+		}
+		portfolio, ok := portfolios[operation.GetPortfolioSlug()]
+		if !ok {
+			return result, fmt.Errorf("invalid operation %d: portfolio '%s' not found", i+1, operation.GetPortfolioSlug())
+		}
+		operation.(referencing).SetReferences(broker, portfolio)
+		key, err := operationJSON(operation)
+		if err != nil {
+			return result, err
+		}
+		if existing[string(key)] > 0 {
+			existing[string(key)]--
+			result.Skipped++
+			continue
+		}
+		operations = append(operations, operation)
+	}
+
+	if dryRun {
+		result.Brokers, result.Portfolios, result.Operations = len(newBrokers), len(newPortfolios), len(operations)
+		return result, nil
+	}
+	err = database.Transaction(func(session db.DB) error {
+		for _, b := range newBrokers {
+			if _, err := session.Create(b); err != nil {
+				return fmt.Errorf("error on insert broker '%s': %v", b.Slug, err)
+			}
+		}
+		for _, p := range newPortfolios {
+			if _, err := session.Create(p); err != nil {
+				return fmt.Errorf("error on insert portfolio '%s': %v", p.Slug, err)
+			}
+		}
+		for i, operation := range operations {
+			if _, err := session.Create(operation.(wallet.Queryable)); err != nil {
+				return fmt.Errorf("error on insert operation %d: %v", i+1, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	result.Brokers, result.Portfolios, result.Operations = len(newBrokers), len(newPortfolios), len(operations)
+	return result, nil
+}
+
+// currentSlugs maps the slugs and aliases of the brokers or portfolios in
+// database to their current slugs.
+func currentSlugs(database db.DB, d wallet.Queryable) (map[string]string, error) {
+	documents, err := database.GetAll(d)
+	if err != nil {
+		return nil, fmt.Errorf("error on retrieve %s: %v", d.GetCollectionName(), err)
+	}
+	slugs := map[string]string{}
+	for _, document := range documents {
+		switch document := document.(type) {
+		case wallet.Broker:
+			addSlugs(slugs, document.Slug, document.Aliases)
+		case wallet.Portfolio:
+			addSlugs(slugs, document.Slug, document.Aliases)
+		}
+	}
+	return slugs, nil
+}
+
+func addSlugs(slugs map[string]string, slug string, aliases []string) {
+	slugs[slug] = slug
+	for _, alias := range aliases {
+		if _, ok := slugs[alias]; !ok {
+			slugs[alias] = slug
+		}
+	}
+}
+
+// existingOperations counts the operations in database by their JSON
+// without ID, which is how imported operations are told apart.
+func existingOperations(database db.DB) (map[string]int, error) {
+	existing := map[string]int{}
+	for _, itemType := range wallet.ItemTypes {
+		operations, err := database.GetAll(wallet.NewOperation(itemType).(wallet.Queryable))
+		if err != nil {
+			return nil, fmt.Errorf("error on retrieve %s operations: %v", itemType, err)
+		}
+		for _, operation := range operations {
+			key, err := operationJSON(operation)
+			if err != nil {
+				return nil, err
+			}
+			existing[string(key)]++
+		}
+	}
+	return existing, nil
+}
+
+// decodeOperation decodes an operation of the type named by its item type,
+// dropping its ID.
+func decodeOperation(raw json.RawMessage) (wallet.Tradable, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "id")
+	var itemType string
+	if err := json.Unmarshal(fields["itemType"], &itemType); err != nil {
+		return nil, fmt.Errorf("missing item type")
+	}
+	operation := wallet.NewOperation(itemType)
+	if operation == nil {
+		return nil, fmt.Errorf("unknown item type '%s'", itemType)
+	}
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, operation); err != nil {
+		return nil, err
+	}
+	return operation, nil
+}
+
+// readOperationsCSV reads operations from a CSV file with a header naming
+// its columns, out of operationColumns. Dates are given as YYYY-MM-DD or
+// RFC 3339.
+func readOperationsCSV(r io.Reader) ([]json.RawMessage, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	header := rows[0]
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+		if !contains(operationColumns, header[i]) {
+			return nil, fmt.Errorf("unknown column '%s'", header[i])
+		}
+	}
+	operations := []json.RawMessage{}
+	for n, row := range rows[1:] {
+		fields := map[string]interface{}{}
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			if i >= len(header) || value == "" {
+				continue
+			}
+			switch column := header[i]; column {
+			case "date", "dueDate":
+				date, err := parseDate(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid %s '%s'", n+2, column, value)
+				}
+				fields[column] = date
+			case "fixedInterestRate":
+				if _, err := strconv.ParseFloat(value, 64); err != nil {
+					return nil, fmt.Errorf("line %d: invalid %s '%s'", n+2, column, value)
+				}
+				fields[column] = json.Number(value)
+			default:
+				fields[column] = value
+			}
+		}
+		raw, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, raw)
+	}
+	return operations, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// ImportPrices saves the price series read from r, in the formats of
+// marketdata.ReadRecords, replacing stored prices of the same day.
+func ImportPrices(database db.DB, r io.Reader, format string, dryRun bool) (ImportResult, error) {
+	result := ImportResult{}
+	records, err := marketdata.ReadRecords(r, format)
+	if err != nil {
+		return result, fmt.Errorf("error on read prices: %v", err)
+	}
+	validate := api.NewValidator()
+	prices := []wallet.Price{}
+	for i, record := range records {
+		date, err := record.ParseDate()
+		if err != nil {
+			return result, fmt.Errorf("invalid date '%s' on price %d", record.Date, i+1)
+		}
+		p := wallet.Price{Date: date, ItemType: record.ItemType, Price: record.Price, Symbol: record.Symbol}
+		if err := validate.Struct(p); err != nil {
+			return result, fmt.Errorf("invalid price %d: %v", i+1, err)
+		}
+		prices = append(prices, p)
+	}
+	if dryRun {
+		result.Prices = int64(len(prices))
+		return result, nil
+	}
+	result.Prices, err = database.SavePrices(prices)
+	return result, err
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/db"
+)
+
+// user administers the actors changes are recorded as made by. The API has
+// no accounts: actors are the free-form names given by the actor header, so
+// they are listed from the history.
+func user(args []string) error {
+	flags := newFlagSet("user")
+	limit := flags.Int64("limit", 20, "most recent changes shown by history, 0 for all")
+	if err := parseFlags(flags, args, 2); err != nil {
+		return err
+	}
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	switch flags.Arg(0) {
+	case "", "list":
+		return ListUsers(database, os.Stdout)
+	case "history":
+		if flags.Arg(1) == "" {
+			flags.Usage()
+			return fmt.Errorf("missing the name of the user")
+		}
+		return UserHistory(database, os.Stdout, flags.Arg(1), *limit)
+	}
+	flags.Usage()
+	return fmt.Errorf("unknown user command '%s'", flags.Arg(0))
+}
+
+// ListUsers writes everyone with changes in the history, with how many
+// changes they made and when they made the last one.
+func ListUsers(database db.DB, w io.Writer) error {
+	actors, err := database.GetActors()
+	if err != nil {
+		return fmt.Errorf("error on retrieve users: %v", err)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER\tCHANGES\tLAST CHANGE")
+	for _, actor := range actors {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", actor.Name, actor.Changes, actor.LastChange.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// UserHistory writes the changes made by name, newest first, up to limit
+// when positive.
+func UserHistory(database db.DB, w io.Writer, name string, limit int64) error {
+	events, err := database.GetActorHistory(name, limit)
+	if err != nil {
+		return fmt.Errorf("error on retrieve the history of '%s': %v", name, err)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tACTION\tCOLLECTION\tDOCUMENT")
+	for _, event := range events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", event.Timestamp.Format(time.RFC3339), event.Action, event.Collection, event.DocumentID)
+	}
+	return tw.Flush()
+}
@@ -4,32 +4,123 @@
 package config
 
 import (
+	"fmt"
 	"strings"
 
+	"github.com/mfinancecombr/finance-wallet-api/logging"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+const envPrefix = "finance.walletapi"
+
+var envReplacer = strings.NewReplacer(".", "_")
+
 func init() {
 	viper.AutomaticEnv()
-	envReplacer := strings.NewReplacer(".", "_")
 	viper.SetEnvKeyReplacer(envReplacer)
-	viper.SetEnvPrefix("finance.walletapi")
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetDefault("db.driver", "mongodb")
+	viper.SetDefault("db.migrate", true)
+	viper.SetDefault("db.connect.retries", 5)
+	viper.SetDefault("db.connect.backoff", 500)
+	viper.SetDefault("db.ping.interval", 5)
+	viper.SetDefault("readyz.timeout", 2)
+	viper.SetDefault("sqlite.path", "finance-wallet.db")
 	viper.SetDefault("mongodb.endpoint", "mongodb://localhost:27017")
 	viper.SetDefault("mongodb.name", "finance-wallet")
 	viper.SetDefault("port", 8889)
+	viper.SetDefault("shutdown.timeout", 10)
 	viper.SetDefault("debug", false)
-	logLevel := log.InfoLevel
-	if viper.GetBool("debug") {
-		logLevel = log.DebugLevel
-	}
-	log.SetLevel(logLevel)
-	log.SetFormatter(&log.TextFormatter{
-		DisableColors: true,
-		FullTimestamp: true,
-	})
+	viper.SetDefault("log.format", "text")
+	viper.SetDefault("timezone", "America/Sao_Paulo")
+	viper.SetDefault("log.level", "info")
+	setupLogging()
+	log.AddHook(logging.Hook{})
 	viper.SetDefault("db.operation.timeout", 3)
 	viper.SetDefault("collection.operation.timeout", 3)
 	viper.SetDefault("financeapi.operation.timeout", 3)
 	viper.SetDefault("financeapi.url", "https://mfinance.com.br/api/v1")
+	viper.SetDefault("financeapi.quotes.ttl", 60)
+	viper.SetDefault("financeapi.retries", 2)
+	viper.SetDefault("financeapi.retry.backoff", 200)
+	viper.SetDefault("financeapi.breaker.failures", 5)
+	viper.SetDefault("financeapi.breaker.cooldown", 30)
+	viper.SetDefault("financeapi.probe.path", "/stocks/?symbols=PETR4")
+	viper.SetDefault("marketdata.providers", "mfinance")
+	viper.SetDefault("marketdata.file.path", "prices.csv")
+	viper.SetDefault("portfolio.workers", 4)
+	viper.SetDefault("tracing.exporter", "none")
+	viper.SetDefault("tracing.otlp.endpoint", "localhost:4318")
+	viper.SetDefault("tracing.otlp.insecure", true)
+	viper.SetDefault("tracing.sample.ratio", 1.0)
+	viper.SetDefault("audit.actor.header", "X-Actor")
+	viper.SetDefault("trash.retention.days", 30)
+	viper.SetDefault("trash.purge.interval", 24)
+	viper.SetDefault("cors.origins", "*")
+	viper.SetDefault("cors.methods", "GET,OPTIONS,POST,DELETE,PUT")
+	viper.SetDefault("cors.credentials", false)
+	viper.SetDefault("security.hsts.maxage", 31536000)
+	viper.SetDefault("tls.cert", "")
+	viper.SetDefault("tls.key", "")
+	viper.SetDefault("tls.selfsigned", false)
+	viper.SetDefault("proxy.trusted", false)
+	viper.SetDefault("ratelimit.enabled", true)
+	viper.SetDefault("ratelimit.default.rate", 20)
+	viper.SetDefault("ratelimit.default.burst", 40)
+	viper.SetDefault("ratelimit.portfolios.rate", 2)
+	viper.SetDefault("ratelimit.portfolios.burst", 10)
+	viper.SetDefault("ratelimit.writes.rate", 10)
+	viper.SetDefault("ratelimit.writes.burst", 20)
+	viper.SetDefault("request.body.limit", "1M")
+	viper.SetDefault("request.import.limit", "16M")
+}
+
+// RateLimitGroups lists the groups of routes limited separately.
+var RateLimitGroups = []string{"default", "portfolios", "writes"}
+
+// Load reads the YAML, TOML or JSON configuration file at path, or at the
+// "config" setting when path is empty, and validates the resulting
+// configuration. Environment variables take precedence over the file. The
+// reloadable settings are applied again whenever the file changes.
+func Load(path string) error {
+	if path == "" {
+		path = viper.GetString("config")
+	}
+	if path != "" {
+		viper.SetConfigFile(path)
+		if err := viper.ReadInConfig(); err != nil {
+			return fmt.Errorf("error on read config file: %v", err)
+		}
+	}
+	if err := Validate(); err != nil {
+		return err
+	}
+	setupLogging()
+	if path != "" {
+		log.Infof("[Config] Using config file %s", path)
+		if err := watch(path); err != nil {
+			log.Warnf("[Config] Error on watch %s, changes need a restart: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func setupLogging() {
+	logLevel, err := log.ParseLevel(viper.GetString("log.level"))
+	if err != nil {
+		logLevel = log.InfoLevel
+	}
+	if viper.GetBool("debug") {
+		logLevel = log.DebugLevel
+	}
+	log.SetLevel(logLevel)
+	if viper.GetString("log.format") == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{
+			DisableColors: true,
+			FullTimestamp: true,
+		})
+	}
 }
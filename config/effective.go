@@ -0,0 +1,72 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const redacted = "REDACTED"
+
+// secretKeys are the words marking a setting as secret.
+var secretKeys = []string{"password", "secret", "token", "key"}
+
+// Effective returns every setting with its current value, hiding secrets:
+// settings named after one, and passwords embedded in URLs.
+func Effective() map[string]interface{} {
+	settings := map[string]interface{}{}
+	for _, key := range viper.AllKeys() {
+		if key == "config" {
+			continue
+		}
+		settings[key] = redact(key, viper.Get(key))
+	}
+	return settings
+}
+
+// Print writes the effective settings, one "key = value" per line sorted by
+// key.
+func Print(w io.Writer) error {
+	settings := Effective()
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s = %v\n", key, settings[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func redact(key string, value interface{}) interface{} {
+	for _, word := range strings.Split(key, ".") {
+		for _, secret := range secretKeys {
+			if strings.Contains(strings.ToLower(word), secret) {
+				return redacted
+			}
+		}
+	}
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+		return u.String()
+	}
+	return value
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Reloadable lists the settings applied again when the config file changes.
+// Every other setting needs a restart.
+var Reloadable = []string{"cors.origins", "debug", "log.level"}
+
+// watch reloads the config file at path whenever it changes. The directory
+// is watched, since editors often replace files instead of writing them.
+func watch(path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == filepath.Clean(path) && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+					if err := reload(path); err != nil {
+						log.Errorf("[Config] Error on reload %s: %v", path, err)
+					}
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Errorf("[Config] Error on watch config file: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// reload applies the reloadable settings of the config file at path,
+// keeping the current ones when any of them is invalid. Settings given as
+// environment variables are kept as well.
+func reload(path string) error {
+	file := viper.New()
+	file.SetConfigFile(path)
+	if err := file.ReadInConfig(); err != nil {
+		return err
+	}
+	previous := map[string]interface{}{}
+	for _, key := range Reloadable {
+		if _, ok := os.LookupEnv(envName(key)); ok || !file.IsSet(key) {
+			continue
+		}
+		previous[key] = viper.Get(key)
+		viper.Set(key, file.Get(key))
+	}
+	if err := Validate(); err != nil {
+		for key, value := range previous {
+			viper.Set(key, value)
+		}
+		return err
+	}
+	setupLogging()
+	log.Infof("[Config] Reloaded %s", path)
+	return nil
+}
+
+func envName(key string) string {
+	return strings.ToUpper(envReplacer.Replace(envPrefix + "_" + key))
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/labstack/gommon/bytes"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// positive lists the settings that must be greater than zero.
+var positive = []string{
+	"collection.operation.timeout",
+	"db.operation.timeout",
+	"db.ping.interval",
+	"financeapi.operation.timeout",
+	"portfolio.workers",
+	"readyz.timeout",
+	"shutdown.timeout",
+}
+
+// nonNegative lists the settings that may be zero, usually to disable some
+// feature, but not negative.
+var nonNegative = []string{
+	"db.connect.backoff",
+	"db.connect.retries",
+	"financeapi.breaker.cooldown",
+	"financeapi.breaker.failures",
+	"financeapi.quotes.ttl",
+	"financeapi.retries",
+	"financeapi.retry.backoff",
+	"security.hsts.maxage",
+	"trash.purge.interval",
+	"trash.retention.days",
+}
+
+var httpMethods = []string{
+	http.MethodConnect, http.MethodDelete, http.MethodGet, http.MethodHead,
+	http.MethodOptions, http.MethodPatch, http.MethodPost, http.MethodPut,
+	http.MethodTrace,
+}
+
+var choices = map[string][]string{
+	"db.driver":        {"mongodb", "sqlite", "memory"},
+	"log.format":       {"text", "json"},
+	"tracing.exporter": {"none", "otlp"},
+}
+
+// Validate checks every setting, reporting all the invalid ones at once.
+func Validate() error {
+	problems := []string{}
+	add := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if port, err := number("port"); err != nil || port < 1 || port > 65535 {
+		add("port must be between 1 and 65535, got '%s'", viper.GetString("port"))
+	}
+	for _, key := range positive {
+		if n, err := number(key); err != nil || n <= 0 {
+			add("%s must be positive, got '%s'", key, viper.GetString(key))
+		}
+	}
+	for _, key := range nonNegative {
+		if n, err := number(key); err != nil || n < 0 {
+			add("%s must be zero or positive, got '%s'", key, viper.GetString(key))
+		}
+	}
+	for key, values := range choices {
+		if !contains(values, viper.GetString(key)) {
+			add("%s must be one of %s, got '%s'", key, strings.Join(values, ", "), viper.GetString(key))
+		}
+	}
+	if ratio, err := number("tracing.sample.ratio"); err != nil || ratio < 0 || ratio > 1 {
+		add("tracing.sample.ratio must be between 0 and 1, got '%s'", viper.GetString("tracing.sample.ratio"))
+	}
+	if _, err := log.ParseLevel(viper.GetString("log.level")); err != nil {
+		add("log.level: %v", err)
+	}
+	if _, err := time.LoadLocation(viper.GetString("timezone")); err != nil {
+		add("timezone: %v", err)
+	}
+	if err := checkURL(viper.GetString("financeapi.url"), "http", "https"); err != nil {
+		add("financeapi.url: %v", err)
+	}
+	if viper.GetString("db.driver") == "mongodb" {
+		if err := checkURL(viper.GetString("mongodb.endpoint"), "mongodb", "mongodb+srv"); err != nil {
+			add("mongodb.endpoint: %v", err)
+		}
+	}
+	if viper.GetString("tracing.exporter") == "otlp" {
+		if _, _, err := net.SplitHostPort(viper.GetString("tracing.otlp.endpoint")); err != nil {
+			add("tracing.otlp.endpoint: %v", err)
+		}
+	}
+	for _, origin := range Origins() {
+		if origin == "*" {
+			if viper.GetBool("cors.credentials") {
+				add("cors.origins must list the allowed origins when cors.credentials is set")
+			}
+			continue
+		}
+		if err := checkURL(origin, "http", "https"); err != nil {
+			add("cors.origins: %v", err)
+		}
+	}
+	for _, method := range Methods() {
+		if !contains(httpMethods, method) {
+			add("cors.methods: unknown method '%s'", method)
+		}
+	}
+	for _, group := range RateLimitGroups {
+		for _, setting := range []string{"rate", "burst"} {
+			key := fmt.Sprintf("ratelimit.%s.%s", group, setting)
+			if n, err := number(key); err != nil || n <= 0 {
+				add("%s must be positive, got '%s'", key, viper.GetString(key))
+			}
+		}
+	}
+	for _, key := range []string{"request.body.limit", "request.import.limit"} {
+		if _, err := bytes.Parse(viper.GetString(key)); err != nil {
+			add("%s must be a size such as 1M, got '%s'", key, viper.GetString(key))
+		}
+	}
+	cert, key := viper.GetString("tls.cert"), viper.GetString("tls.key")
+	if (cert == "") != (key == "") {
+		add("tls.cert and tls.key must be set together")
+	}
+	if cert != "" && viper.GetBool("tls.selfsigned") {
+		add("tls.selfsigned cannot be used with tls.cert")
+	}
+	for _, path := range []string{cert, key} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			add("tls: %v", err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Origins returns the origins allowed to make cross-origin requests, as
+// listed by the comma separated "cors.origins" setting.
+func Origins() []string {
+	origins := []string{}
+	for _, origin := range strings.Split(viper.GetString("cors.origins"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// Methods returns the HTTP methods allowed in cross-origin requests, as
+// listed by the comma separated "cors.methods" setting.
+func Methods() []string {
+	methods := []string{}
+	for _, method := range strings.Split(viper.GetString("cors.methods"), ",") {
+		if method = strings.ToUpper(strings.TrimSpace(method)); method != "" {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+func number(key string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(viper.GetString(key)), 64)
+}
+
+func checkURL(raw string, schemes ...string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if !contains(schemes, u.Scheme) || u.Host == "" {
+		return fmt.Errorf("'%s' is not a %s URL", raw, strings.Join(schemes, " or "))
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
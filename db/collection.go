@@ -5,108 +5,112 @@ package db
 
 import (
 	"context"
-	"time"
+	"errors"
+	"strings"
 
-	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
+// ErrDuplicateKey is wrapped by errors caused by unique index violations.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// Collection is implemented by each storage backend. Documents and queries
+// are expressed as BSON, using the subset of MongoDB query operators needed
+// by DB: equality (also against array elements), $or, $exists, $lt, $lte,
+// $gt, $gte and $in, and the $set and $unset update operators. Aggregation
+// pipelines are limited to the $match, $sort and $group stages, grouping by
+// top-level fields with the $push accumulator.
 type Collection interface {
-	DeleteOne(c string, d interface{}) (*mongo.DeleteResult, error)
-	Distinct(c string, q string, f interface{}) ([]interface{}, error)
-	FindAll(c string, q bson.M, o ...*options.FindOptions) ([]bson.M, error)
+	Aggregate(c string, pipeline []bson.M) ([]bson.M, error)
+	// Close releases the connections to the backend.
+	Close() error
+	CountDocuments(c string, q bson.M) (int64, error)
+	CreateIndex(c string, i Index) error
+	DeleteMany(c string, q bson.M) (*DeleteResult, error)
+	DeleteOne(c string, q bson.M) (*DeleteResult, error)
+	Distinct(c string, field string, q bson.M) ([]interface{}, error)
+	// DropIndex removes an index created by CreateIndex, if it exists.
+	DropIndex(c string, i Index) error
+	FindAll(c string, q bson.M, o ...*FindOptions) ([]bson.M, error)
 	FindOne(c string, q bson.M, r interface{}) error
-	InsertOne(c string, d interface{}) (*mongo.InsertOneResult, error)
+	InsertOne(c string, d interface{}) (*InsertResult, error)
 	Ping() error
-	UpdateOne(c string, f, d interface{}) (*mongo.UpdateResult, error)
+	// ReplaceOne replaces the first document matching q with d, inserting d
+	// when none matches.
+	ReplaceOne(c string, q bson.M, d interface{}) (*UpdateResult, error)
+	Transaction(fn func(Collection) error) error
+	UpdateMany(c string, q, u bson.M) (*UpdateResult, error)
+	UpdateOne(c string, q, u bson.M) (*UpdateResult, error)
+	// WithContext returns a collection whose operations are cancelled when
+	// ctx is done.
+	WithContext(ctx context.Context) Collection
 }
 
-type mongoCollection struct {
-	dbName  string
-	session *mongo.Client
+type Index struct {
+	Field string
+	// With lists the other fields of a compound index.
+	With   []string
+	Unique bool
 }
 
-func newCollectionContext() (context.Context, context.CancelFunc) {
-	log.Debug("[Collection] New collection context")
-	timeout := viper.GetDuration("collection.operation.timeout")
-	return context.WithTimeout(context.Background(), timeout*time.Second)
+func (i Index) fields() []string {
+	return append([]string{i.Field}, i.With...)
 }
 
-func (m *mongoCollection) Ping() error {
-	log.Debug("[Collection] Ping")
-	ctx, _ := newCollectionContext()
-	return m.session.Ping(ctx, readpref.Primary())
+// key identifies the index by its comma separated fields.
+func (i Index) key() string {
+	return strings.Join(i.fields(), ",")
 }
 
-func (m *mongoCollection) InsertOne(c string, d interface{}) (*mongo.InsertOneResult, error) {
-	log.Debug("[Collection] InsertOne")
-	collection := m.session.Database(m.dbName).Collection(c)
-	ctx, _ := newCollectionContext()
-	return collection.InsertOne(ctx, d)
+type SortField struct {
+	Field string
+	// Order is 1 for ascending and -1 for descending.
+	Order int
 }
 
-func (m *mongoCollection) FindAll(c string, q bson.M, o ...*options.FindOptions) ([]bson.M, error) {
-	log.Debug("[Collection] FindAll")
-	collection := m.session.Database(m.dbName).Collection(c)
-	ctx, _ := newCollectionContext()
-	cur, err := collection.Find(ctx, q, o...)
-	if err != nil {
-		log.Errorf("[Collection] Find: %s", err)
-		return nil, err
-	}
-	var results []bson.M
-	defer cur.Close(ctx)
-	for cur.Next(ctx) {
-		var result bson.M
-		if err := cur.Decode(&result); err != nil {
-			log.Errorf("[Collection] Decode: %s", err)
-			return nil, err
-		}
-		results = append(results, result)
-	}
-	if err := cur.Err(); err != nil {
-		log.Errorf("[Collection] Cursor: %s", err)
-		return nil, err
-	}
-	return results, nil
+type FindOptions struct {
+	Limit int64
+	Sort  []SortField
 }
 
-func (m *mongoCollection) FindOne(c string, q bson.M, r interface{}) error {
-	log.Debug("[Collection] FindOne...")
-	collection := m.session.Database(m.dbName).Collection(c)
-	ctx, _ := newCollectionContext()
-	err := collection.FindOne(ctx, q).Decode(r)
-	if err == mongo.ErrNoDocuments {
-		return nil
-	}
-	if err != nil {
-		log.Errorf("[Collection] Error on retrieve data: %s", err)
-		return err
+func FindSorted(field string, order int) *FindOptions {
+	return &FindOptions{Sort: []SortField{{Field: field, Order: order}}}
+}
+
+func (o *FindOptions) SetLimit(limit int64) *FindOptions {
+	o.Limit = limit
+	return o
+}
+
+// mergeFindOptions combines options the way the MongoDB driver does: later
+// values win.
+func mergeFindOptions(opts ...*FindOptions) *FindOptions {
+	result := &FindOptions{}
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Limit != 0 {
+			result.Limit = o.Limit
+		}
+		if o.Sort != nil {
+			result.Sort = o.Sort
+		}
 	}
-	return nil
+	return result
 }
 
-func (m *mongoCollection) DeleteOne(c string, d interface{}) (*mongo.DeleteResult, error) {
-	log.Debug("[Collection] DeleteOne")
-	collection := m.session.Database(m.dbName).Collection(c)
-	ctx, _ := newCollectionContext()
-	return collection.DeleteOne(ctx, d)
+type InsertResult struct {
+	InsertedID interface{}
 }
 
-func (m *mongoCollection) UpdateOne(c string, f, d interface{}) (*mongo.UpdateResult, error) {
-	log.Debug("[Collection] UpdateOne")
-	collection := m.session.Database(m.dbName).Collection(c)
-	ctx, _ := newCollectionContext()
-	return collection.UpdateOne(ctx, f, d)
+type UpdateResult struct {
+	MatchedCount  int64
+	ModifiedCount int64
+	UpsertedCount int64
+	UpsertedID    interface{}
 }
 
-func (m *mongoCollection) Distinct(c string, q string, f interface{}) ([]interface{}, error) {
-	log.Debug("[Collection] Distinct")
-	collection := m.session.Database(m.dbName).Collection(c)
-	ctx, _ := newCollectionContext()
-	return collection.Distinct(ctx, q, f)
+type DeleteResult struct {
+	DeletedCount int64
 }
@@ -0,0 +1,36 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ErrUnavailable is wrapped by the error of sessions created while the
+// database could not be reached. Such sessions keep trying to reconnect.
+var ErrUnavailable = errors.New("database unavailable")
+
+// pingWithRetries pings the database until it answers, waiting twice as
+// long after each failed attempt.
+func pingWithRetries(collection Collection) error {
+	retries := viper.GetInt("db.connect.retries")
+	backoff := viper.GetDuration("db.connect.backoff") * time.Millisecond
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			log.Warnf("[DB] Database unreachable, retrying in %s: %v", backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = collection.Ping(); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
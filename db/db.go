@@ -5,6 +5,8 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/mfinancecombr/finance-wallet-api/wallet"
@@ -12,9 +14,6 @@ import (
 	"github.com/spf13/viper"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/x/bsonx"
 )
 
 // FIXME
@@ -22,117 +21,308 @@ const (
 	brokersCollection    = "brokers"
 	portfoliosCollection = "portfolios"
 	operationsCollection = "operations"
+	historyCollection    = "history"
 )
 
-type mongoSession struct {
+// documentDB implements DB on top of any storage backend implementing
+// Collection.
+type documentDB struct {
+	actor      string
+	ctx        context.Context
 	collection Collection
+	// transaction is set on sessions bound to a transaction, which nested
+	// transactions join.
+	transaction bool
+}
+
+// WithContext returns a session whose operations are cancelled when ctx is
+// done, such as when the client of a request goes away.
+func (m *documentDB) WithContext(ctx context.Context) DB {
+	return &documentDB{actor: m.actor, ctx: ctx, collection: m.collection.WithContext(ctx), transaction: m.transaction}
+}
+
+func (m *documentDB) context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+// logger returns the logger of the session, tagging entries with the request
+// bound to its context.
+func (m *documentDB) logger() *log.Entry {
+	return log.WithContext(m.context())
+}
+
+// Close disconnects from the database.
+func (m *documentDB) Close() error {
+	m.logger().Debug("[DB] Close")
+	return m.collection.Close()
 }
 
 type DB interface {
-	Create(d wallet.Queryable) (*mongo.InsertOneResult, error)
-	Delete(collectionName, id string) (*mongo.DeleteResult, error)
+	Create(d wallet.Queryable) (*InsertResult, error)
+	Delete(collectionName, id string) (*DeleteResult, error)
 	Get(id string, d wallet.Queryable) error
 	GetAll(q wallet.Queryable) ([]wallet.Queryable, error)
 	GetBySlug(slug string, d wallet.Queryable) error
-	Update(id string, d wallet.Queryable) (*mongo.UpdateResult, error)
+	Rename(id string, d wallet.Queryable, field, from, to string) (*UpdateResult, error)
+	Transaction(fn func(DB) error) error
+	Update(id string, d wallet.Queryable) (*UpdateResult, error)
+
+	GetPortfolioData(p *wallet.Portfolio, asOf time.Time) error
+	GetPortfoliosData(p []*wallet.Portfolio, asOf time.Time) error
+	RebuildPositions() (int64, error)
+	CheckPositions() ([]string, error)
 
-	GetPortfolioData(p *wallet.Portfolio, year int) error
+	BackfillPrices(to time.Time) (int64, error)
+	GetPriceAt(itemType, symbol string, date time.Time) (*wallet.Price, error)
+	GetPrices(itemType, symbol string, from, to time.Time) ([]wallet.Price, error)
+	SavePrices(prices []wallet.Price) (int64, error)
+
+	Migrate() (int, error)
+	PendingMigrations() (int, error)
 	GetAllOperations() (interface{}, error)
 	GetAllPurchases() (interface{}, error)
 	GetAllSales() (interface{}, error)
 
+	Count(collectionName string) (int64, error)
+	CountOperationsByItemType() (map[string]int64, error)
+	CountOperationsByReference(field, slug string) (int64, error)
+	DeleteOperationsByReference(field, slug string) (*DeleteResult, error)
+	ReassignOperations(field, from, to string) (*UpdateResult, error)
+
+	GetActorHistory(actor string, limit int64) ([]wallet.HistoryEvent, error)
+	GetActors() ([]wallet.Actor, error)
+	GetAuditFeed(collectionName string, limit int64) ([]wallet.HistoryEvent, error)
+	GetHistory(id string) ([]wallet.HistoryEvent, error)
+	WithActor(actor string) DB
+	WithContext(ctx context.Context) DB
+
+	GetTrash() (map[string][]wallet.TrashedDocument, error)
+	GetTrashed(collectionName, id string, d interface{}) error
+	PurgeTrash(before time.Time) (int64, error)
+	Restore(collectionName, id string) (*UpdateResult, error)
+
+	Close() error
 	Ping() error
 }
 
-func (m *mongoSession) GetBySlug(slug string, d wallet.Queryable) error {
-	log.Debug("[DB] GetBySlug")
-	query := bson.M{"slug": slug}
+// GetBySlug retrieves a document by its current slug or by any slug it had
+// before being renamed.
+func (m *documentDB) GetBySlug(slug string, d wallet.Queryable) error {
+	m.logger().Debug("[DB] GetBySlug")
+	query := active(bson.M{"$or": []bson.M{{"slug": slug}, {"aliases": slug}}})
 	return m.collection.FindOne(d.GetCollectionName(), query, d)
 }
 
-func (m *mongoSession) Get(id string, d wallet.Queryable) error {
-	log.Debug("[DB] Get")
+func (m *documentDB) Get(id string, d wallet.Queryable) error {
+	m.logger().Debug("[DB] Get")
 	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return err
 	}
-	query := bson.M{"_id": objectId}
+	query := active(bson.M{"_id": objectId})
 	return m.collection.FindOne(d.GetCollectionName(), query, d)
 }
 
-func (m *mongoSession) GetAll(d wallet.Queryable) ([]wallet.Queryable, error) {
-	log.Debug("[DB] GetAll")
+func (m *documentDB) GetAll(d wallet.Queryable) ([]wallet.Queryable, error) {
+	m.logger().Debug("[DB] GetAll")
 	query := bson.M{}
 	if d.GetItemType() != "" {
 		query = bson.M{"itemType": d.GetItemType()}
 	}
-	results, err := m.collection.FindAll(d.GetCollectionName(), query)
+	results, err := m.collection.FindAll(d.GetCollectionName(), active(query))
 	if err != nil {
 		return nil, err
 	}
 	operationsList := []wallet.Queryable{}
 	for _, result := range results {
-		bsonBytes, _ := bson.Marshal(result)
-		bson.Unmarshal(bsonBytes, d)
-		operationsList = append(operationsList, d)
+		// Each result needs its own value of the type of d.
+		t := reflect.TypeOf(d)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		item := reflect.New(t)
+		if err := decodeDocument(result, item.Interface()); err != nil {
+			return nil, err
+		}
+		if reflect.TypeOf(d).Kind() == reflect.Ptr {
+			operationsList = append(operationsList, item.Interface().(wallet.Queryable))
+		} else {
+			operationsList = append(operationsList, item.Elem().Interface().(wallet.Queryable))
+		}
 	}
 	return operationsList, nil
 }
 
-func (m *mongoSession) Create(d wallet.Queryable) (*mongo.InsertOneResult, error) {
-	log.Debug("[DB] Create")
-	return m.collection.InsertOne(d.GetCollectionName(), d)
+// Create inserts a document, recording it in the history in the same
+// transaction.
+func (m *documentDB) Create(d wallet.Queryable) (*InsertResult, error) {
+	m.logger().Debug("[DB] Create")
+	var result *InsertResult
+	err := m.inTransaction(func(session *documentDB) error {
+		var err error
+		result, err = session.create(d)
+		return err
+	})
+	return result, err
 }
 
-func (m *mongoSession) Update(id string, d wallet.Queryable) (*mongo.UpdateResult, error) {
-	log.Debug("[DB] Update")
-	objectId, err := primitive.ObjectIDFromHex(id)
+func (m *documentDB) create(d wallet.Queryable) (*InsertResult, error) {
+	result, err := m.collection.InsertOne(d.GetCollectionName(), d)
 	if err != nil {
 		return nil, err
 	}
-	dMarshal, _ := bson.Marshal(d)
-	doc, err := bsonx.ReadDoc(dMarshal)
-	doc = doc.Delete("_id")
-	f := bson.D{{"_id", objectId}}
-	u := bson.D{{"$set", doc}}
-	return m.collection.UpdateOne(d.GetCollectionName(), f, u)
+	if objectId, ok := result.InsertedID.(primitive.ObjectID); ok {
+		after := bson.M{}
+		q := bson.M{"_id": objectId}
+		if err := m.collection.FindOne(d.GetCollectionName(), q, &after); err != nil {
+			m.logger().Errorf("[DB] Error on retrieve created document: %s", err)
+		}
+		if err := m.changed(d.GetCollectionName(), wallet.HistoryCreate, nil, after); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Update replaces the fields of a document, recording the change in the
+// history in the same transaction.
+func (m *documentDB) Update(id string, d wallet.Queryable) (*UpdateResult, error) {
+	m.logger().Debug("[DB] Update")
+	var result *UpdateResult
+	err := m.inTransaction(func(session *documentDB) error {
+		var err error
+		result, err = session.update(id, d)
+		return err
+	})
+	return result, err
 }
 
-func (m *mongoSession) Delete(collectionName, id string) (*mongo.DeleteResult, error) {
-	log.Debug("[DB] Delete")
+func (m *documentDB) update(id string, d wallet.Queryable) (*UpdateResult, error) {
 	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, err
 	}
-	q := bson.M{"_id": objectId}
-	return m.collection.DeleteOne(collectionName, q)
+	dMarshal, _ := bson.Marshal(d)
+	doc := bson.M{}
+	if err := bson.Unmarshal(dMarshal, &doc); err != nil {
+		return nil, err
+	}
+	delete(doc, "_id")
+	q := active(bson.M{"_id": objectId})
+	before := bson.M{}
+	if err := m.collection.FindOne(d.GetCollectionName(), q, &before); err != nil {
+		return nil, err
+	}
+	u := bson.M{"$set": doc}
+	result, err := m.collection.UpdateOne(d.GetCollectionName(), q, u)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount != 0 {
+		after := bson.M{}
+		if err := m.collection.FindOne(d.GetCollectionName(), q, &after); err != nil {
+			m.logger().Errorf("[DB] Error on retrieve updated document: %s", err)
+		}
+		if err := m.changed(d.GetCollectionName(), wallet.HistoryUpdate, before, after); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Transaction runs fn with a session bound to a transaction, when the server
+// supports it, so the changes made through it are saved together or not at
+// all. Sessions already in a transaction run fn within it.
+func (m *documentDB) Transaction(fn func(DB) error) error {
+	return m.inTransaction(func(session *documentDB) error {
+		return fn(session)
+	})
+}
+
+// inTransaction runs fn as Transaction does. Every change runs in one, so
+// it is never saved without its history event.
+func (m *documentDB) inTransaction(fn func(*documentDB) error) error {
+	if m.transaction {
+		return fn(m)
+	}
+	return m.collection.Transaction(func(c Collection) error {
+		return fn(&documentDB{actor: m.actor, ctx: m.ctx, collection: c, transaction: true})
+	})
+}
+
+// Rename updates a document whose slug changed from "from" to "to" and
+// rewrites field on every operation referencing the old slug, in a single
+// transaction when the server supports it.
+func (m *documentDB) Rename(id string, d wallet.Queryable, field, from, to string) (*UpdateResult, error) {
+	m.logger().Debugf("[DB] Rename %s -> %s", from, to)
+	var result *UpdateResult
+	err := m.Transaction(func(session DB) error {
+		var err error
+		if result, err = session.Update(id, d); err != nil {
+			return err
+		}
+		_, err = session.ReassignOperations(field, from, to)
+		return err
+	})
+	return result, err
 }
 
-func newDBContext() (context.Context, context.CancelFunc) {
-	log.Debug("[DB] New DB context")
-	timeout := viper.GetDuration("db.operation.timeout")
-	return context.WithTimeout(context.Background(), timeout*time.Second)
+// Delete moves a document to the trash. It is hidden from every query until
+// restored, and permanently removed by PurgeTrash after the retention period.
+func (m *documentDB) Delete(collectionName, id string) (*DeleteResult, error) {
+	m.logger().Debug("[DB] Delete")
+	var result *DeleteResult
+	err := m.inTransaction(func(session *documentDB) error {
+		var err error
+		result, err = session.delete(collectionName, id)
+		return err
+	})
+	return result, err
 }
 
-func NewMongoSession() (DB, error) {
-	log.Debug("[DB] New mongo session")
-	dbURI := viper.GetString("mongodb.endpoint")
-	dbName := viper.GetString("mongodb.name")
-	ctx, _ := newDBContext()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(dbURI))
+func (m *documentDB) delete(collectionName, id string) (*DeleteResult, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	q := active(bson.M{"_id": objectId})
+	before := bson.M{}
+	if err := m.collection.FindOne(collectionName, q, &before); err != nil {
+		return nil, err
+	}
+	u := bson.M{"$set": bson.M{deletedAtField: time.Now().UTC()}}
+	result, err := m.collection.UpdateOne(collectionName, q, u)
 	if err != nil {
-		log.Errorf("[DB] Error on create mongo session: %s", err)
+		return nil, err
 	}
-	mongo := &mongoSession{
-		collection: &mongoCollection{
-			session: client,
-			dbName:  dbName,
-		},
+	if result.ModifiedCount != 0 {
+		if err := m.changed(collectionName, wallet.HistoryDelete, before, nil); err != nil {
+			return nil, err
+		}
 	}
-	return mongo, err
+	return &DeleteResult{DeletedCount: result.ModifiedCount}, nil
 }
 
-func (m *mongoSession) Ping() error {
-	log.Debug("[DB] Ping")
+func (m *documentDB) Ping() error {
+	m.logger().Debug("[DB] Ping")
 	return m.collection.Ping()
 }
+
+// New returns the DB backed by the storage selected by the "db.driver"
+// setting.
+func New() (DB, error) {
+	driver := viper.GetString("db.driver")
+	log.Debugf("[DB] Using %s driver", driver)
+	switch driver {
+	case "mongodb":
+		return NewMongoSession()
+	case "sqlite":
+		return NewSQLiteSession()
+	case "memory":
+		return NewMemorySession(), nil
+	}
+	return nil, fmt.Errorf("unknown database driver '%s'", driver)
+}
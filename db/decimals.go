@@ -0,0 +1,62 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"fmt"
+
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Fields stored as doubles before money values became wallet.Decimal.
+var decimalFields = map[string][]string{
+	operationsCollection: {"commission", "price", "shares"},
+	portfoliosCollection: {"costBasis", "gain", "overallReturn"},
+}
+
+func toDecimal(v interface{}) (wallet.Decimal, error) {
+	switch n := v.(type) {
+	case float64:
+		return wallet.NewDecimalFromFloat(n), nil
+	case int32:
+		return wallet.NewDecimalFromInt(int64(n)), nil
+	case int64:
+		return wallet.NewDecimalFromInt(n), nil
+	}
+	return wallet.Zero, fmt.Errorf("unexpected number type %T", v)
+}
+
+// migrateDecimals rewrites money values stored as doubles or integers as
+// Decimal128. Documents already converted are left untouched, so it is safe
+// to run more than once.
+func (m *documentDB) migrateDecimals() error {
+	m.logger().Debug("[DB] Migrating numbers to decimals")
+	for c, fields := range decimalFields {
+		for _, field := range fields {
+			docs, err := m.collection.FindAll(c, bson.M{field: bson.M{"$exists": true}})
+			if err != nil {
+				return err
+			}
+			converted := 0
+			for _, doc := range docs {
+				d, err := toDecimal(doc[field])
+				if err != nil {
+					// Already a decimal.
+					continue
+				}
+				f := bson.M{"_id": doc["_id"]}
+				u := bson.M{"$set": bson.M{field: d}}
+				if _, err := m.collection.UpdateOne(c, f, u); err != nil {
+					return err
+				}
+				converted++
+			}
+			if converted > 0 {
+				m.logger().Infof("[DB] Converted %s of %d %s to decimal", field, converted, c)
+			}
+		}
+	}
+	return nil
+}
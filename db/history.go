@@ -0,0 +1,114 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WithActor returns a session that records its changes in the history as
+// made by actor.
+func (m *documentDB) WithActor(actor string) DB {
+	return &documentDB{actor: actor, ctx: m.ctx, collection: m.collection, transaction: m.transaction}
+}
+
+// recordHistory appends a change event to the history collection. The
+// history is append-only: events are never updated or deleted. Changes are
+// made in a transaction, which the returned error rolls back, so they are
+// never saved without their event.
+func (m *documentDB) recordHistory(collectionName, action string, before, after bson.M) error {
+	var documentID string
+	for _, doc := range []bson.M{before, after} {
+		if objectId, ok := doc["_id"].(primitive.ObjectID); ok {
+			documentID = objectId.Hex()
+			break
+		}
+	}
+	event := &wallet.HistoryEvent{
+		Action:     action,
+		Actor:      m.actor,
+		After:      after,
+		Before:     before,
+		Collection: collectionName,
+		DocumentID: documentID,
+		Timestamp:  time.Now().UTC(),
+	}
+	if _, err := m.collection.InsertOne(historyCollection, event); err != nil {
+		m.logger().Errorf("[DB] Error on record %s history of '%s': %s", action, documentID, err)
+		return err
+	}
+	return nil
+}
+
+func (m *documentDB) findHistory(q bson.M, limit int64) ([]wallet.HistoryEvent, error) {
+	// Events recorded in the same millisecond keep their insertion order
+	// through their ObjectIDs.
+	opts := FindSorted("timestamp", -1)
+	opts.Sort = append(opts.Sort, SortField{Field: "_id", Order: -1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	results, err := m.collection.FindAll(historyCollection, q, opts)
+	if err != nil {
+		return nil, err
+	}
+	events := []wallet.HistoryEvent{}
+	for _, result := range results {
+		event := wallet.HistoryEvent{}
+		bsonBytes, _ := bson.Marshal(result)
+		bson.Unmarshal(bsonBytes, &event)
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (m *documentDB) GetHistory(id string) ([]wallet.HistoryEvent, error) {
+	m.logger().Debugf("[DB] GetHistory %s", id)
+	return m.findHistory(bson.M{"documentId": id}, 0)
+}
+
+func (m *documentDB) GetAuditFeed(collectionName string, limit int64) ([]wallet.HistoryEvent, error) {
+	m.logger().Debug("[DB] GetAuditFeed")
+	q := bson.M{}
+	if collectionName != "" {
+		q["collection"] = collectionName
+	}
+	return m.findHistory(q, limit)
+}
+
+// GetActorHistory returns the changes made by actor, newest first, up to
+// limit when positive.
+func (m *documentDB) GetActorHistory(actor string, limit int64) ([]wallet.HistoryEvent, error) {
+	m.logger().Debugf("[DB] GetActorHistory %s", actor)
+	return m.findHistory(bson.M{"actor": actor}, limit)
+}
+
+// GetActors returns everyone with changes in the history, sorted by name.
+func (m *documentDB) GetActors() ([]wallet.Actor, error) {
+	m.logger().Debug("[DB] GetActors")
+	events, err := m.findHistory(bson.M{}, 0)
+	if err != nil {
+		return nil, err
+	}
+	// Events are newest first, so the first one of an actor is its last
+	// change.
+	index := map[string]int{}
+	actors := []wallet.Actor{}
+	for _, event := range events {
+		i, ok := index[event.Actor]
+		if !ok {
+			i = len(actors)
+			index[event.Actor] = i
+			actors = append(actors, wallet.Actor{Name: event.Actor, LastChange: event.Timestamp})
+		}
+		actors[i].Changes++
+	}
+	sort.Slice(actors, func(i, j int) bool { return actors[i].Name < actors[j].Name })
+	return actors, nil
+}
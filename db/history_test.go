@@ -0,0 +1,86 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// failingHistory is a collection unable to record history.
+type failingHistory struct {
+	Collection
+}
+
+func (f failingHistory) InsertOne(c string, d interface{}) (*InsertResult, error) {
+	if c == historyCollection {
+		return nil, errors.New("history unavailable")
+	}
+	return f.Collection.InsertOne(c, d)
+}
+
+func (f failingHistory) Transaction(fn func(Collection) error) error {
+	return f.Collection.Transaction(func(c Collection) error {
+		return fn(failingHistory{c})
+	})
+}
+
+func TestRenameRecordsHistoryInTransaction(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, session *documentDB) {
+		result, err := session.Create(&wallet.Portfolio{Name: "Default", Slug: "default"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := result.InsertedID.(primitive.ObjectID).Hex()
+
+		failing := &documentDB{actor: "test", collection: failingHistory{session.collection}}
+		renamed := &wallet.Portfolio{Aliases: []string{"default"}, Name: "Default", Slug: "renamed"}
+		if _, err := failing.Rename(id, renamed, PortfolioSlugField, "default", "renamed"); err == nil {
+			t.Fatal("expected the rename to fail without history")
+		}
+
+		portfolio := &wallet.Portfolio{}
+		if err := session.Get(id, portfolio); err != nil {
+			t.Fatal(err)
+		}
+		if portfolio.Slug != "default" {
+			t.Fatalf("expected the rename to be rolled back, got %+v", portfolio)
+		}
+	})
+}
+
+func TestChangesRollBackWithoutHistory(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, session *documentDB) {
+		failing := &documentDB{actor: "test", collection: failingHistory{session.collection}}
+		if _, err := failing.Create(&wallet.Broker{Name: "Broker", Slug: "broker"}); err == nil {
+			t.Fatal("expected the create to fail without history")
+		}
+		if n, err := session.Count(brokersCollection); err != nil || n != 0 {
+			t.Fatalf("expected the create to be rolled back, got %d brokers (%v)", n, err)
+		}
+
+		result, err := session.Create(&wallet.Broker{Name: "Broker", Slug: "broker"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := result.InsertedID.(primitive.ObjectID).Hex()
+		if _, err := failing.Update(id, &wallet.Broker{Name: "Renamed", Slug: "broker"}); err == nil {
+			t.Fatal("expected the update to fail without history")
+		}
+		if _, err := failing.Delete(brokersCollection, id); err == nil {
+			t.Fatal("expected the delete to fail without history")
+		}
+
+		broker := &wallet.Broker{}
+		if err := session.Get(id, broker); err != nil {
+			t.Fatal(err)
+		}
+		if broker.Name != "Broker" {
+			t.Fatalf("expected the update and delete to be rolled back, got %+v", broker)
+		}
+	})
+}
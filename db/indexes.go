@@ -0,0 +1,61 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+// slugIndex keeps slugs unique among active documents: including deletedAt,
+// which is missing unless in the trash, lets new documents take the slugs of
+// deleted ones. Restoring them checks the slugs are still available.
+var slugIndex = Index{Field: "slug", With: []string{deletedAtField}, Unique: true}
+
+// indexes lists the indexes of each collection. Backends other than MongoDB
+// only enforce the unique ones.
+var indexes = map[string][]Index{
+	brokersCollection:    {slugIndex},
+	portfoliosCollection: {slugIndex},
+	operationsCollection: {
+		{Field: "symbol"},
+		{Field: "itemType"},
+		{Field: "date"},
+		{Field: BrokerSlugField},
+		{Field: PortfolioSlugField},
+	},
+	positionsCollection: {{Field: PortfolioSlugField}},
+	pricesCollection: {
+		{Field: "symbol"},
+		{Field: "date"},
+	},
+	historyCollection: {
+		{Field: "documentId"},
+		{Field: "timestamp"},
+	},
+}
+
+// createIndexes creates every index in indexes. Creating an existing index
+// does nothing.
+func (m *documentDB) createIndexes() error {
+	m.logger().Debug("[DB] Creating indexes")
+	for c, list := range indexes {
+		for _, index := range list {
+			if err := m.collection.CreateIndex(c, index); err != nil {
+				m.logger().Errorf("[DB] Error on create %s %s index: %s", c, index.key(), err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reuseTrashedSlugs replaces the slug indexes covering documents in the trash
+// by slugIndex.
+func (m *documentDB) reuseTrashedSlugs() error {
+	for _, c := range []string{brokersCollection, portfoliosCollection} {
+		if err := m.collection.DropIndex(c, Index{Field: "slug", Unique: true}); err != nil {
+			return err
+		}
+		if err := m.collection.CreateIndex(c, slugIndex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/metrics"
+	"github.com/mfinancecombr/finance-wallet-api/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentedCollection records the latency and errors of the operations of a
+// backend, and traces them as children of the span in its context.
+type instrumentedCollection struct {
+	backend    string
+	ctx        context.Context
+	collection Collection
+}
+
+func instrument(backend string, collection Collection) Collection {
+	return &instrumentedCollection{backend: backend, collection: collection}
+}
+
+// observe starts measuring an operation. The returned function ends it and
+// is deferred by operations, with err pointing to their result.
+func (m *instrumentedCollection) observe(operation, c string) func(err *error) {
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := tracing.Tracer().Start(ctx, "db."+operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", m.backend),
+			attribute.String("db.operation", operation),
+			attribute.String("db.collection", c),
+		))
+	start := time.Now()
+	return func(err *error) {
+		metrics.DBDuration.WithLabelValues(m.backend, operation, c).Observe(time.Since(start).Seconds())
+		if *err != nil {
+			metrics.DBErrors.WithLabelValues(m.backend, operation, c).Inc()
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+	}
+}
+
+func (m *instrumentedCollection) Aggregate(c string, pipeline []bson.M) (r []bson.M, err error) {
+	defer m.observe("aggregate", c)(&err)
+	return m.collection.Aggregate(c, pipeline)
+}
+
+func (m *instrumentedCollection) Close() error {
+	return m.collection.Close()
+}
+
+func (m *instrumentedCollection) CountDocuments(c string, q bson.M) (r int64, err error) {
+	defer m.observe("count", c)(&err)
+	return m.collection.CountDocuments(c, q)
+}
+
+func (m *instrumentedCollection) CreateIndex(c string, i Index) (err error) {
+	defer m.observe("create_index", c)(&err)
+	return m.collection.CreateIndex(c, i)
+}
+
+func (m *instrumentedCollection) DeleteMany(c string, q bson.M) (r *DeleteResult, err error) {
+	defer m.observe("delete_many", c)(&err)
+	return m.collection.DeleteMany(c, q)
+}
+
+func (m *instrumentedCollection) DeleteOne(c string, q bson.M) (r *DeleteResult, err error) {
+	defer m.observe("delete_one", c)(&err)
+	return m.collection.DeleteOne(c, q)
+}
+
+func (m *instrumentedCollection) Distinct(c string, field string, q bson.M) (r []interface{}, err error) {
+	defer m.observe("distinct", c)(&err)
+	return m.collection.Distinct(c, field, q)
+}
+
+func (m *instrumentedCollection) DropIndex(c string, i Index) (err error) {
+	defer m.observe("drop_index", c)(&err)
+	return m.collection.DropIndex(c, i)
+}
+
+func (m *instrumentedCollection) FindAll(c string, q bson.M, o ...*FindOptions) (r []bson.M, err error) {
+	defer m.observe("find", c)(&err)
+	return m.collection.FindAll(c, q, o...)
+}
+
+func (m *instrumentedCollection) FindOne(c string, q bson.M, r interface{}) (err error) {
+	defer m.observe("find_one", c)(&err)
+	return m.collection.FindOne(c, q, r)
+}
+
+func (m *instrumentedCollection) InsertOne(c string, d interface{}) (r *InsertResult, err error) {
+	defer m.observe("insert_one", c)(&err)
+	return m.collection.InsertOne(c, d)
+}
+
+func (m *instrumentedCollection) Ping() (err error) {
+	defer m.observe("ping", "")(&err)
+	return m.collection.Ping()
+}
+
+func (m *instrumentedCollection) ReplaceOne(c string, q bson.M, d interface{}) (r *UpdateResult, err error) {
+	defer m.observe("replace_one", c)(&err)
+	return m.collection.ReplaceOne(c, q, d)
+}
+
+func (m *instrumentedCollection) Transaction(fn func(Collection) error) (err error) {
+	defer m.observe("transaction", "")(&err)
+	return m.collection.Transaction(func(tx Collection) error {
+		return fn(&instrumentedCollection{backend: m.backend, ctx: m.ctx, collection: tx})
+	})
+}
+
+func (m *instrumentedCollection) UpdateMany(c string, q, u bson.M) (r *UpdateResult, err error) {
+	defer m.observe("update_many", c)(&err)
+	return m.collection.UpdateMany(c, q, u)
+}
+
+func (m *instrumentedCollection) UpdateOne(c string, q, u bson.M) (r *UpdateResult, err error) {
+	defer m.observe("update_one", c)(&err)
+	return m.collection.UpdateOne(c, q, u)
+}
+
+func (m *instrumentedCollection) WithContext(ctx context.Context) Collection {
+	return &instrumentedCollection{backend: m.backend, ctx: ctx, collection: m.collection.WithContext(ctx)}
+}
@@ -0,0 +1,339 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryData maps collection names to documents, encoded as BSON so callers
+// never share state with the store, keyed by documentKey.
+type memoryData map[string]map[string][]byte
+
+func (d memoryData) clone() memoryData {
+	result := memoryData{}
+	for c, docs := range d {
+		result[c] = map[string][]byte{}
+		for k, v := range docs {
+			result[c][k] = v
+		}
+	}
+	return result
+}
+
+type memoryStore struct {
+	mu      sync.RWMutex
+	data    memoryData
+	indexes map[string][]string
+}
+
+// memoryCollection keeps documents in memory. It is meant for tests and
+// throwaway instances: nothing survives a restart.
+type memoryCollection struct {
+	store *memoryStore
+	// tx holds the working copy of a transaction, applied on success.
+	tx memoryData
+}
+
+func (m *memoryCollection) rLock() func() {
+	if m.tx != nil {
+		return func() {}
+	}
+	m.store.mu.RLock()
+	return m.store.mu.RUnlock
+}
+
+func (m *memoryCollection) lock() func() {
+	if m.tx != nil {
+		return func() {}
+	}
+	m.store.mu.Lock()
+	return m.store.mu.Unlock
+}
+
+func (m *memoryCollection) data() memoryData {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.store.data
+}
+
+// load returns the documents of c ordered by key, which for ObjectIDs is the
+// insertion order.
+func (m *memoryCollection) load(c string) ([]bson.M, error) {
+	stored := m.data()[c]
+	keys := make([]string, 0, len(stored))
+	for k := range stored {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	docs := make([]bson.M, 0, len(keys))
+	for _, k := range keys {
+		doc := bson.M{}
+		if err := bson.Unmarshal(stored[k], &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func (m *memoryCollection) save(c string, doc bson.M) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if m.data()[c] == nil {
+		m.data()[c] = map[string][]byte{}
+	}
+	m.data()[c][documentKey(doc["_id"])] = data
+	return nil
+}
+
+func (m *memoryCollection) Ping() error {
+	log.Debug("[Collection] Ping")
+	return nil
+}
+
+func (m *memoryCollection) InsertOne(c string, d interface{}) (*InsertResult, error) {
+	log.Debug("[Collection] InsertOne")
+	defer m.lock()()
+	doc, err := toDocument(d)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := doc["_id"]; !ok {
+		doc["_id"] = primitive.NewObjectID()
+	}
+	docs, err := m.load(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUnique(doc, docs, m.store.indexes[c]); err != nil {
+		return nil, err
+	}
+	if _, exists := m.data()[c][documentKey(doc["_id"])]; exists {
+		return nil, fmt.Errorf("%w: _id '%v'", ErrDuplicateKey, doc["_id"])
+	}
+	if err := m.save(c, doc); err != nil {
+		return nil, err
+	}
+	return &InsertResult{InsertedID: doc["_id"]}, nil
+}
+
+func (m *memoryCollection) FindAll(c string, q bson.M, o ...*FindOptions) ([]bson.M, error) {
+	log.Debug("[Collection] FindAll")
+	defer m.rLock()()
+	docs, err := m.load(c)
+	if err != nil {
+		return nil, err
+	}
+	return findDocuments(docs, q, o...)
+}
+
+func (m *memoryCollection) Aggregate(c string, pipeline []bson.M) ([]bson.M, error) {
+	log.Debug("[Collection] Aggregate")
+	defer m.rLock()()
+	docs, err := m.load(c)
+	if err != nil {
+		return nil, err
+	}
+	return aggregateDocuments(docs, pipeline)
+}
+
+func (m *memoryCollection) FindOne(c string, q bson.M, r interface{}) error {
+	log.Debug("[Collection] FindOne...")
+	results, err := m.FindAll(c, q, &FindOptions{Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	return decodeDocument(results[0], r)
+}
+
+func (m *memoryCollection) CountDocuments(c string, q bson.M) (int64, error) {
+	log.Debug("[Collection] CountDocuments")
+	results, err := m.FindAll(c, q)
+	return int64(len(results)), err
+}
+
+func (m *memoryCollection) Distinct(c string, field string, q bson.M) ([]interface{}, error) {
+	log.Debug("[Collection] Distinct")
+	results, err := m.FindAll(c, q)
+	if err != nil {
+		return nil, err
+	}
+	return distinctValues(results, field), nil
+}
+
+func (m *memoryCollection) update(c string, q, u bson.M, limit int64) (*UpdateResult, error) {
+	defer m.lock()()
+	docs, err := m.load(c)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := findDocuments(docs, q, &FindOptions{Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	result := &UpdateResult{MatchedCount: int64(len(targets))}
+	for _, doc := range targets {
+		updated, err := applyUpdate(doc, u)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkUnique(updated, docs, m.store.indexes[c]); err != nil {
+			return nil, err
+		}
+		if equalDocuments(doc, updated) {
+			continue
+		}
+		if err := m.save(c, updated); err != nil {
+			return nil, err
+		}
+		result.ModifiedCount++
+	}
+	return result, nil
+}
+
+func (m *memoryCollection) ReplaceOne(c string, q bson.M, d interface{}) (*UpdateResult, error) {
+	log.Debug("[Collection] ReplaceOne")
+	defer m.lock()()
+	docs, err := m.load(c)
+	if err != nil {
+		return nil, err
+	}
+	doc, inserted, err := replaceDocument(docs, q, d)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUnique(doc, docs, m.store.indexes[c]); err != nil {
+		return nil, err
+	}
+	if err := m.save(c, doc); err != nil {
+		return nil, err
+	}
+	if inserted {
+		return &UpdateResult{UpsertedCount: 1, UpsertedID: doc["_id"]}, nil
+	}
+	return &UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+func (m *memoryCollection) UpdateOne(c string, q, u bson.M) (*UpdateResult, error) {
+	log.Debug("[Collection] UpdateOne")
+	return m.update(c, q, u, 1)
+}
+
+func (m *memoryCollection) UpdateMany(c string, q, u bson.M) (*UpdateResult, error) {
+	log.Debug("[Collection] UpdateMany")
+	return m.update(c, q, u, 0)
+}
+
+func (m *memoryCollection) delete(c string, q bson.M, limit int64) (*DeleteResult, error) {
+	defer m.lock()()
+	docs, err := m.load(c)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := findDocuments(docs, q, &FindOptions{Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range targets {
+		delete(m.data()[c], documentKey(doc["_id"]))
+	}
+	return &DeleteResult{DeletedCount: int64(len(targets))}, nil
+}
+
+func (m *memoryCollection) DeleteOne(c string, q bson.M) (*DeleteResult, error) {
+	log.Debug("[Collection] DeleteOne")
+	return m.delete(c, q, 1)
+}
+
+func (m *memoryCollection) DeleteMany(c string, q bson.M) (*DeleteResult, error) {
+	log.Debug("[Collection] DeleteMany")
+	return m.delete(c, q, 0)
+}
+
+func (m *memoryCollection) CreateIndex(c string, i Index) error {
+	log.Debug("[Collection] CreateIndex")
+	if !i.Unique {
+		return nil
+	}
+	defer m.lock()()
+	for _, key := range m.store.indexes[c] {
+		if key == i.key() {
+			return nil
+		}
+	}
+	docs, err := m.load(c)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if err := checkUnique(doc, docs, []string{i.key()}); err != nil {
+			return err
+		}
+	}
+	m.store.indexes[c] = append(m.store.indexes[c], i.key())
+	return nil
+}
+
+func (m *memoryCollection) DropIndex(c string, i Index) error {
+	log.Debug("[Collection] DropIndex")
+	defer m.lock()()
+	m.store.indexes[c] = removeIndexKey(m.store.indexes[c], i.key())
+	return nil
+}
+
+// WithContext returns the collection itself: memory operations never block.
+func (m *memoryCollection) WithContext(ctx context.Context) Collection {
+	return m
+}
+
+func (m *memoryCollection) Close() error {
+	return nil
+}
+
+// Transaction runs fn against a copy of the data, which replaces the
+// original only if fn succeeds.
+func (m *memoryCollection) Transaction(fn func(Collection) error) error {
+	log.Debug("[Collection] Transaction")
+	if m.tx != nil {
+		return fn(m)
+	}
+	defer m.lock()()
+	tx := &memoryCollection{store: m.store, tx: m.store.data.clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	m.store.data = tx.tx
+	return nil
+}
+
+// NewMemorySession returns an empty DB kept in memory.
+func NewMemorySession() DB {
+	log.Debug("[DB] New memory session")
+	session := &documentDB{
+		collection: instrument("memory", &memoryCollection{
+			store: &memoryStore{
+				data:    memoryData{},
+				indexes: map[string][]string{},
+			},
+		}),
+	}
+	if _, err := session.Migrate(); err != nil {
+		log.Errorf("[DB] Error on migrate: %s", err)
+	}
+	return session
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const migrationsCollection = "migrations"
+
+// migration is a versioned change to the stored data. Migrations must be
+// safe to run again, as a failure may happen after apply succeeded.
+type migration struct {
+	version     int
+	description string
+	apply       func(m *documentDB) error
+}
+
+// migrations must be kept in version order; never renumber or remove a
+// released one.
+var migrations = []migration{
+	{1, "Create indexes", (*documentDB).createIndexes},
+	{2, "Store money values as decimals", (*documentDB).migrateDecimals},
+	{3, "Normalize item types", (*documentDB).normalizeItemTypes},
+	{4, "Materialize positions", func(m *documentDB) error {
+		_, err := m.RebuildPositions()
+		return err
+	}},
+	{5, "Create price indexes", (*documentDB).createIndexes},
+	{6, "Let new documents reuse the slugs of deleted ones", (*documentDB).reuseTrashedSlugs},
+}
+
+type appliedMigration struct {
+	AppliedAt   time.Time `bson:"appliedAt"`
+	Description string    `bson:"description"`
+	Version     int       `bson:"_id"`
+}
+
+// legacyItemTypes maps item types stored by older versions to the current
+// ones, which match the API routes.
+var legacyItemTypes = map[string]string{
+	"certificate-of-deposit": wallet.CertificateOfDepositItemType,
+	"treasury-direct":        wallet.TreasuryDirectItemType,
+}
+
+func (m *documentDB) normalizeItemTypes() error {
+	for legacy, itemType := range legacyItemTypes {
+		u := bson.M{"$set": bson.M{"itemType": itemType}}
+		result, err := m.collection.UpdateMany(operationsCollection, bson.M{"itemType": legacy}, u)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount > 0 {
+			m.logger().Infof("[DB] Renamed item type of %d operations from %s to %s", result.ModifiedCount, legacy, itemType)
+		}
+	}
+	return nil
+}
+
+// appliedVersions returns the versions of the applied migrations.
+func (m *documentDB) appliedVersions() (map[int]bool, error) {
+	results, err := m.collection.FindAll(migrationsCollection, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int]bool{}
+	for _, result := range results {
+		a := appliedMigration{}
+		if err := decodeDocument(result, &a); err != nil {
+			return nil, err
+		}
+		applied[a.Version] = true
+	}
+	return applied, nil
+}
+
+// PendingMigrations returns how many migrations were not applied yet.
+func (m *documentDB) PendingMigrations() (int, error) {
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, mig := range migrations {
+		if !applied[mig.version] {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies the pending migrations in order, returning how many were
+// applied.
+func (m *documentDB) Migrate() (int, error) {
+	m.logger().Debug("[DB] Migrate")
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, mig := range migrations {
+		if applied[mig.version] {
+			continue
+		}
+		m.logger().Infof("[DB] Applying migration %d: %s", mig.version, mig.description)
+		if err := mig.apply(m); err != nil {
+			return count, fmt.Errorf("migration %d (%s): %w", mig.version, mig.description, err)
+		}
+		record := &appliedMigration{
+			AppliedAt:   time.Now().UTC(),
+			Description: mig.description,
+			Version:     mig.version,
+		}
+		if _, err := m.collection.InsertOne(migrationsCollection, record); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// autoMigrate runs Migrate when enabled by the "db.migrate" setting.
+func (m *documentDB) autoMigrate() {
+	if !viper.GetBool("db.migrate") {
+		return
+	}
+	if _, err := m.Migrate(); err != nil {
+		m.logger().Errorf("[DB] Error on migrate: %s", err)
+	}
+}
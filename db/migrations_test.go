@@ -0,0 +1,65 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMigrate(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, session *documentDB) {
+		count, err := session.Migrate()
+		if err != nil || count != 0 {
+			t.Fatalf("expected no pending migrations, got %d (%v)", count, err)
+		}
+
+		// Simulate data written by an older version.
+		legacy := bson.M{
+			"itemType":      "certificate-of-deposit",
+			"date":          time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+			"portfolioSlug": "default",
+			"price":         10.5,
+			"shares":        int32(2),
+			"symbol":        "CDB",
+			"type":          "purchase",
+		}
+		if _, err := session.collection.InsertOne(operationsCollection, legacy); err != nil {
+			t.Fatal(err)
+		}
+		for _, version := range []int{2, 3, 4} {
+			if _, err := session.collection.DeleteOne(migrationsCollection, bson.M{"_id": version}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		count, err = session.Migrate()
+		if err != nil || count != 3 {
+			t.Fatalf("expected 3 migrations applied, got %d (%v)", count, err)
+		}
+
+		operation := &wallet.CertificateOfDeposit{}
+		if err := session.collection.FindOne(operationsCollection, bson.M{}, operation); err != nil {
+			t.Fatal(err)
+		}
+		if operation.ItemType != wallet.CertificateOfDepositItemType {
+			t.Fatalf("item type not normalized: %s", operation.ItemType)
+		}
+		if operation.Price.String() != "10.5" || operation.Shares.String() != "2" {
+			t.Fatalf("unexpected decimals: %s %s", operation.Price, operation.Shares)
+		}
+
+		portfolio := &wallet.Portfolio{Slug: "default"}
+		if err := session.GetPortfolioData(portfolio, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		positions := portfolio.Items[wallet.CertificateOfDepositItemType]
+		if len(positions) != 1 || positions[0].CostBasis.String() != "21" {
+			t.Fatalf("unexpected positions %+v", portfolio.Items)
+		}
+	})
+}
@@ -0,0 +1,341 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+type mongoCollection struct {
+	ctx     context.Context
+	dbName  string
+	session *mongo.Client
+}
+
+// illegalOperationCode is returned by standalone servers, which do not
+// support transactions.
+const illegalOperationCode = 20
+
+// noTransactionsWarning is logged once, as every change runs in a
+// transaction.
+var noTransactionsWarning sync.Once
+
+func (m *mongoCollection) context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+func (m *mongoCollection) logger() *log.Entry {
+	return log.WithContext(m.context())
+}
+
+func (m *mongoCollection) newCollectionContext() (context.Context, context.CancelFunc) {
+	m.logger().Debug("[Collection] New collection context")
+	timeout := viper.GetDuration("collection.operation.timeout")
+	return context.WithTimeout(m.context(), timeout*time.Second)
+}
+
+func (m *mongoCollection) Ping() error {
+	m.logger().Debug("[Collection] Ping")
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	return m.session.Ping(ctx, readpref.Primary())
+}
+
+// mongoError wraps unique index violations with ErrDuplicateKey.
+func mongoError(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %v", ErrDuplicateKey, err)
+	}
+	return err
+}
+
+func mongoUpdateResult(r *mongo.UpdateResult, err error) (*UpdateResult, error) {
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return &UpdateResult{
+		MatchedCount:  r.MatchedCount,
+		ModifiedCount: r.ModifiedCount,
+		UpsertedCount: r.UpsertedCount,
+		UpsertedID:    r.UpsertedID,
+	}, nil
+}
+
+func mongoDeleteResult(r *mongo.DeleteResult, err error) (*DeleteResult, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &DeleteResult{DeletedCount: r.DeletedCount}, nil
+}
+
+func mongoFindOptions(o ...*FindOptions) *options.FindOptions {
+	opts := mergeFindOptions(o...)
+	result := options.Find()
+	if opts.Limit > 0 {
+		result.SetLimit(opts.Limit)
+	}
+	if len(opts.Sort) > 0 {
+		sort := bson.D{}
+		for _, s := range opts.Sort {
+			sort = append(sort, bson.E{Key: s.Field, Value: s.Order})
+		}
+		result.SetSort(sort)
+	}
+	return result
+}
+
+func (m *mongoCollection) InsertOne(c string, d interface{}) (*InsertResult, error) {
+	m.logger().Debug("[Collection] InsertOne")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	result, err := collection.InsertOne(ctx, d)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return &InsertResult{InsertedID: result.InsertedID}, nil
+}
+
+func (m *mongoCollection) FindAll(c string, q bson.M, o ...*FindOptions) ([]bson.M, error) {
+	m.logger().Debug("[Collection] FindAll")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	cur, err := collection.Find(ctx, q, mongoFindOptions(o...))
+	if err != nil {
+		m.logger().Errorf("[Collection] Find: %s", err)
+		return nil, err
+	}
+	var results []bson.M
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var result bson.M
+		if err := cur.Decode(&result); err != nil {
+			m.logger().Errorf("[Collection] Decode: %s", err)
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	if err := cur.Err(); err != nil {
+		m.logger().Errorf("[Collection] Cursor: %s", err)
+		return nil, err
+	}
+	return results, nil
+}
+
+func (m *mongoCollection) Aggregate(c string, pipeline []bson.M) ([]bson.M, error) {
+	m.logger().Debug("[Collection] Aggregate")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	cur, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		m.logger().Errorf("[Collection] Aggregate: %s", err)
+		return nil, err
+	}
+	var results []bson.M
+	if err := cur.All(ctx, &results); err != nil {
+		m.logger().Errorf("[Collection] Cursor: %s", err)
+		return nil, err
+	}
+	return results, nil
+}
+
+func (m *mongoCollection) FindOne(c string, q bson.M, r interface{}) error {
+	m.logger().Debug("[Collection] FindOne...")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	err := collection.FindOne(ctx, q).Decode(r)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		m.logger().Errorf("[Collection] Error on retrieve data: %s", err)
+		return err
+	}
+	return nil
+}
+
+func (m *mongoCollection) DeleteOne(c string, q bson.M) (*DeleteResult, error) {
+	m.logger().Debug("[Collection] DeleteOne")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	return mongoDeleteResult(collection.DeleteOne(ctx, q))
+}
+
+func (m *mongoCollection) DeleteMany(c string, q bson.M) (*DeleteResult, error) {
+	m.logger().Debug("[Collection] DeleteMany")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	return mongoDeleteResult(collection.DeleteMany(ctx, q))
+}
+
+func (m *mongoCollection) UpdateOne(c string, q, u bson.M) (*UpdateResult, error) {
+	m.logger().Debug("[Collection] UpdateOne")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	return mongoUpdateResult(collection.UpdateOne(ctx, q, u))
+}
+
+func (m *mongoCollection) ReplaceOne(c string, q bson.M, d interface{}) (*UpdateResult, error) {
+	m.logger().Debug("[Collection] ReplaceOne")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	opts := options.Replace().SetUpsert(true)
+	return mongoUpdateResult(collection.ReplaceOne(ctx, q, d, opts))
+}
+
+func (m *mongoCollection) UpdateMany(c string, q, u bson.M) (*UpdateResult, error) {
+	m.logger().Debug("[Collection] UpdateMany")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	return mongoUpdateResult(collection.UpdateMany(ctx, q, u))
+}
+
+func (m *mongoCollection) CountDocuments(c string, q bson.M) (int64, error) {
+	m.logger().Debug("[Collection] CountDocuments")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	return collection.CountDocuments(ctx, q)
+}
+
+func (m *mongoCollection) Distinct(c string, field string, q bson.M) ([]interface{}, error) {
+	m.logger().Debug("[Collection] Distinct")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	return collection.Distinct(ctx, field, q)
+}
+
+func (m *mongoCollection) CreateIndex(c string, i Index) error {
+	m.logger().Debug("[Collection] CreateIndex")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	keys := bson.D{}
+	for _, field := range i.fields() {
+		keys = append(keys, bson.E{Key: field, Value: 1})
+	}
+	index := mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetUnique(i.Unique),
+	}
+	_, err := collection.Indexes().CreateOne(ctx, index)
+	return err
+}
+
+// Error codes returned when dropping an index of a missing collection or a
+// missing index.
+const (
+	namespaceNotFoundCode = 26
+	indexNotFoundCode     = 27
+)
+
+func (m *mongoCollection) DropIndex(c string, i Index) error {
+	m.logger().Debug("[Collection] DropIndex")
+	collection := m.session.Database(m.dbName).Collection(c)
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	// Indexes are named after their fields, as "slug_1_deletedAt_1".
+	names := []string{}
+	for _, field := range i.fields() {
+		names = append(names, field+"_1")
+	}
+	_, err := collection.Indexes().DropOne(ctx, strings.Join(names, "_"))
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == indexNotFoundCode || cmdErr.Code == namespaceNotFoundCode) {
+		return nil
+	}
+	return err
+}
+
+// Transaction runs fn with a collection bound to a transaction. Servers
+// without transaction support (standalone deployments) run fn directly.
+func (m *mongoCollection) Transaction(fn func(Collection) error) error {
+	m.logger().Debug("[Collection] Transaction")
+	session, err := m.session.StartSession()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := m.newCollectionContext()
+	defer cancel()
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(&mongoCollection{ctx: sc, dbName: m.dbName, session: m.session})
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == illegalOperationCode {
+		noTransactionsWarning.Do(func() {
+			m.logger().Warnf("[Collection] Transactions not supported, running without: %s", err)
+		})
+		return fn(m)
+	}
+	return err
+}
+
+func (m *mongoCollection) WithContext(ctx context.Context) Collection {
+	return &mongoCollection{ctx: ctx, dbName: m.dbName, session: m.session}
+}
+
+func (m *mongoCollection) Close() error {
+	m.logger().Debug("[Collection] Close")
+	ctx, cancel := newDBContext()
+	defer cancel()
+	return m.session.Disconnect(ctx)
+}
+
+func newDBContext() (context.Context, context.CancelFunc) {
+	log.Debug("[DB] New DB context")
+	timeout := viper.GetDuration("db.operation.timeout")
+	return context.WithTimeout(context.Background(), timeout*time.Second)
+}
+
+func NewMongoSession() (DB, error) {
+	log.Debug("[DB] New mongo session")
+	dbURI := viper.GetString("mongodb.endpoint")
+	dbName := viper.GetString("mongodb.name")
+	ctx, cancel := newDBContext()
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(dbURI))
+	if err != nil {
+		log.Errorf("[DB] Error on create mongo session: %s", err)
+	}
+	session := &documentDB{
+		collection: instrument("mongodb", &mongoCollection{
+			session: client,
+			dbName:  dbName,
+		}),
+	}
+	if err != nil {
+		return session, err
+	}
+	if err := pingWithRetries(session.collection); err != nil {
+		log.Errorf("[DB] Error on connect to mongo: %s", err)
+		return session, err
+	}
+	session.autoMigrate()
+	return session, nil
+}
@@ -4,75 +4,90 @@
 package db
 
 import (
-	"time"
+	"sort"
 
 	"github.com/mfinancecombr/finance-wallet-api/wallet"
 	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func (m *mongoSession) getOperationsSymbols(filter bson.M) ([]interface{}, error) {
-	log.Debug("[DB] getOperationSymbols")
-	return m.collection.Distinct(operationsCollection, "symbol", filter)
+// operationGroup holds the operations of one symbol in a portfolio.
+type operationGroup struct {
+	ID         positionKey `bson:"_id"`
+	Operations []bson.Raw  `bson:"operations"`
+	// materialized holds the stored totals of groups read from the
+	// positions collection.
+	materialized *storedPosition
 }
 
-func (m *mongoSession) getItemTypes() ([]interface{}, error) {
-	log.Debug("[DB] getItemTypes")
-	return m.collection.Distinct(operationsCollection, "itemType", bson.M{})
-}
-
-func (m *mongoSession) getAllOperationsBySymbol(symbol, itemType string, year int) (wallet.OperationsList, error) {
-	log.Debug("[DB] getAllOperationsBySymbol")
-	date := time.Date(year, 12, 31, 23, 59, 59, 0, time.UTC)
-	query := bson.M{"symbol": symbol, "date": bson.M{"$lte": date}}
-	opts := options.Find().SetSort(bson.D{{"date", 1}})
-	results, err := m.collection.FindAll(operationsCollection, query, opts)
+// getOperationGroups retrieves with a single query the operations matching
+// q, sorted by date and grouped by portfolio, item type and symbol.
+func (m *documentDB) getOperationGroups(query bson.M) ([]operationGroup, error) {
+	m.logger().Debug("[DB] getOperationGroups")
+	pipeline := []bson.M{
+		{"$match": active(query)},
+		{"$sort": bson.D{{Key: "date", Value: 1}}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"itemType":      "$itemType",
+				"portfolioSlug": "$portfolioSlug",
+				"symbol":        "$symbol",
+			},
+			"operations": bson.M{"$push": "$$ROOT"},
+		}},
+	}
+	results, err := m.collection.Aggregate(operationsCollection, pipeline)
 	if err != nil {
 		return nil, err
 	}
-	// FIXME
+	groups := make([]operationGroup, len(results))
+	for i, result := range results {
+		if err := decodeDocument(result, &groups[i]); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i].ID, groups[j].ID
+		if a.ItemType != b.ItemType {
+			return a.ItemType < b.ItemType
+		}
+		return a.Symbol < b.Symbol
+	})
+	return groups, nil
+}
+
+func (g operationGroup) operationsList() wallet.OperationsList {
 	operationsList := wallet.OperationsList{}
-	for _, result := range results {
-		var operation wallet.Tradable
-		switch itemType {
-		case "stocks":
-			operation = &wallet.Stock{}
-		case "fiis":
-			operation = &wallet.FII{}
-		case "certificates-of-deposit":
-			operation = &wallet.CertificateOfDeposit{}
-		case "treasuries-direct":
-			operation = &wallet.TreasuryDirect{}
-		case "stocks-funds":
-			operation = &wallet.StockFund{}
-		case "ficfi":
-			operation = &wallet.FICFI{}
-		default:
-			log.Errorf("Item type '%s' not found", itemType)
+	for _, raw := range g.Operations {
+		operation := wallet.NewOperation(g.ID.ItemType)
+		if operation == nil {
+			log.Errorf("Item type '%s' not found", g.ID.ItemType)
+			continue
+		}
+		if err := bson.Unmarshal(raw, operation); err != nil {
+			log.Errorf("[DB] Error on decode operation: %v", err)
+			continue
 		}
-		bsonBytes, _ := bson.Marshal(result)
-		bson.Unmarshal(bsonBytes, operation)
 		operationsList = append(operationsList, operation)
 	}
-	return operationsList, nil
+	return operationsList
 }
 
-func (m *mongoSession) GetAllOperations() (interface{}, error) {
-	log.Debug("[DB] GetAllOperations")
-	return m.collection.FindAll(operationsCollection, bson.M{})
+func (m *documentDB) GetAllOperations() (interface{}, error) {
+	m.logger().Debug("[DB] GetAllOperations")
+	return m.collection.FindAll(operationsCollection, active(bson.M{}))
 }
 
-func (m *mongoSession) GetAllPurchases() (interface{}, error) {
-	log.Debug("[DB] GetAllOperations")
+func (m *documentDB) GetAllPurchases() (interface{}, error) {
+	m.logger().Debug("[DB] GetAllOperations")
 	query := bson.M{"type": "purchase"}
-	opts := options.Find().SetSort(bson.D{{"date", -1}})
-	return m.collection.FindAll(operationsCollection, query, opts)
+	opts := FindSorted("date", -1)
+	return m.collection.FindAll(operationsCollection, active(query), opts)
 }
 
-func (m *mongoSession) GetAllSales() (interface{}, error) {
-	log.Debug("[DB] GetAllOperations")
+func (m *documentDB) GetAllSales() (interface{}, error) {
+	m.logger().Debug("[DB] GetAllOperations")
 	query := bson.M{"type": "sale"}
-	opts := options.Find().SetSort(bson.D{{"date", -1}})
-	return m.collection.FindAll(operationsCollection, query, opts)
+	opts := FindSorted("date", -1)
+	return m.collection.FindAll(operationsCollection, active(query), opts)
 }
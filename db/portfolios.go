@@ -4,81 +4,147 @@
 package db
 
 import (
-	"fmt"
+	"context"
+	"sync"
+	"time"
 
-	"github.com/mfinancecombr/finance-wallet-api/financeapi"
+	"github.com/mfinancecombr/finance-wallet-api/marketdata"
 	"github.com/mfinancecombr/finance-wallet-api/wallet"
 	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
-func (m *mongoSession) getPositionsByItemType(itemType string, year int) ([]wallet.Position, error) {
-	log.Debugf("[DB] Getting portfolio item %s", itemType)
-	operationsSymbols, err := m.getOperationsSymbols(bson.M{"itemType": itemType})
+// getQuotes retrieves the quotes of symbols, keyed by symbol. Symbols
+// without any known quote are missing from the result; failed reports
+// whether the market data could not be retrieved.
+func getQuotes(ctx context.Context, itemType string, symbols []string) (quotesMap map[string]wallet.Position, failed bool) {
+	log.WithContext(ctx).Debugf("[DB] Getting %s quotes", itemType)
+	quotes, err := marketdata.GetQuotes(ctx, itemType, symbols)
 	if err != nil {
-		return nil, err
+		log.WithContext(ctx).Warnf("Error on get %s symbols: %v", itemType, err)
 	}
 
-	// Get all data by itemType
-	query := ""
-	for _, s := range operationsSymbols {
-		query += fmt.Sprintf("symbols=%s&", s)
-	}
-	tempPosition := &map[string][]wallet.Position{}
-	url := fmt.Sprintf("/%s/?%s", itemType, query)
-	if err := financeapi.GetJSON(url, tempPosition); err != nil {
-		log.Warnf("Error on get %s symbols: %v", itemType, err)
-	}
-
-	// Convert to map of symbols
 	symbolsMap := map[string]wallet.Position{}
-	for _, a := range *tempPosition {
-		for _, item := range a {
-			symbolsMap[item.Symbol] = item
+	for symbol, quote := range quotes {
+		quotedAt := quote.Time
+		symbolsMap[symbol] = wallet.Position{
+			Change:       quote.Change,
+			ClosingPrice: quote.ClosingPrice,
+			LastPrice:    quote.LastPrice,
+			LastYearHigh: quote.LastYearHigh,
+			LastYearLow:  quote.LastYearLow,
+			Name:         quote.Name,
+			QuoteStale:   quote.Stale,
+			QuotedAt:     &quotedAt,
+			Sector:       quote.Sector,
+			Segment:      quote.Segment,
+			SubSector:    quote.SubSector,
+			Symbol:       symbol,
 		}
 	}
+	return symbolsMap, err != nil
+}
 
-	items := []wallet.Position{}
-	for _, s := range operationsSymbols {
-		symbol := s.(string)
-		operations, err := m.getAllOperationsBySymbol(symbol, itemType, year)
-		if err != nil {
-			return nil, err
-		}
-
-		var position wallet.Position
-		if val, ok := symbolsMap[symbol]; ok {
-			position = val
-		} else {
-			position = wallet.Position{}
-		}
-
-		position.Symbol = symbol
-		position.ItemType = itemType
-		position.Operations = operations
-		position.Recalculate()
-		items = append(items, position)
+// GetPortfoliosData fills the positions of every portfolio at asOf, using
+// one query for the operations and one finance API request per item type.
+// A zero asOf values them now, and a past one at the stored prices.
+func (m *documentDB) GetPortfoliosData(portfolios []*wallet.Portfolio, asOf time.Time) error {
+	m.logger().Debug("[DB] GetPortfoliosData")
+	bySlug := map[string]*wallet.Portfolio{}
+	slugs := []string{}
+	for _, p := range portfolios {
+		p.Items = map[string][]wallet.Position{}
+		bySlug[p.Slug] = p
+		slugs = append(slugs, p.Slug)
 	}
 
-	return items, nil
-}
-
-func (m *mongoSession) GetPortfolioData(portfolio *wallet.Portfolio, year int) error {
-	log.Debug("[DB] GetPositions")
-	itemTypes, err := m.getItemTypes()
+	// Materialized positions hold every operation, so they answer for the
+	// present only; any other date, even a future one, leaves out the
+	// operations after it.
+	var groups []operationGroup
+	var err error
+	if asOf.IsZero() {
+		groups, err = m.getMaterializedGroups(slugs)
+	} else {
+		// Operation dates are calendar days stored as midnight UTC, so
+		// asOf includes the operations of its day in its timezone.
+		endOfDay := day(asOf).AddDate(0, 0, 1)
+		query := bson.M{"portfolioSlug": bson.M{"$in": slugs}, "date": bson.M{"$lt": endOfDay}}
+		groups, err = m.getOperationGroups(query)
+	}
 	if err != nil {
 		return err
 	}
-	portfolio.Items = map[string][]wallet.Position{}
-	for _, itemType := range itemTypes {
-		kind := itemType.(string)
-		positions, err := m.getPositionsByItemType(kind, year)
-		if err != nil {
-			log.Errorf("[DB] Error on get portfolio items: %v", err)
-			continue
+
+	symbols := map[string][]string{}
+	seen := map[string]bool{}
+	for _, g := range groups {
+		key := g.ID.ItemType + "/" + g.ID.Symbol
+		if !seen[key] {
+			seen[key] = true
+			symbols[g.ID.ItemType] = append(symbols[g.ID.ItemType], g.ID.Symbol)
 		}
-		portfolio.Items[kind] = positions
 	}
-	portfolio.Recalculate()
+	// Each item type needs a finance API request or a query per stored
+	// price, so they are retrieved concurrently. Past dates are valued at the
+	// stored price of their day, never at live quotes: positions without one
+	// are left unquoted and marked stale.
+	current := asOf.IsZero() || asOf.After(time.Now())
+	var mu sync.Mutex
+	quotes := map[string]map[string]wallet.Position{}
+	stale := map[string]bool{}
+	jobs := []func(){}
+	for itemType, s := range symbols {
+		itemType, s := itemType, s
+		jobs = append(jobs, func() {
+			var q map[string]wallet.Position
+			missingStale := true
+			if current {
+				q, missingStale = getQuotes(m.context(), itemType, s)
+			} else {
+				q = m.getPricesAt(itemType, s, day(asOf))
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			quotes[itemType], stale[itemType] = q, missingStale
+		})
+	}
+	if err := runWorkers(m.context(), jobs); err != nil {
+		return err
+	}
+
+	positions := make([]wallet.Position, len(groups))
+	jobs = []func(){}
+	for i, g := range groups {
+		i, g := i, g
+		jobs = append(jobs, func() {
+			position, ok := quotes[g.ID.ItemType][g.ID.Symbol]
+			if !ok && stale[g.ID.ItemType] {
+				position.QuoteStale = true
+			}
+			positions[i] = g.position(position)
+		})
+	}
+	if err := runWorkers(m.context(), jobs); err != nil {
+		return err
+	}
+	for i, g := range groups {
+		p := bySlug[g.ID.PortfolioSlug]
+		p.Items[g.ID.ItemType] = append(p.Items[g.ID.ItemType], positions[i])
+	}
+
+	jobs = []func(){}
+	for _, p := range portfolios {
+		p := p
+		jobs = append(jobs, p.Recalculate)
+	}
+	if err := runWorkers(m.context(), jobs); err != nil {
+		return err
+	}
 	return nil
 }
+
+func (m *documentDB) GetPortfolioData(portfolio *wallet.Portfolio, asOf time.Time) error {
+	m.logger().Debug("[DB] GetPortfolioData")
+	return m.GetPortfoliosData([]*wallet.Portfolio{portfolio}, asOf)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func createDeposit(t *testing.T, session *documentDB, date time.Time) {
+	t.Helper()
+	deposit := wallet.NewCertificateOfDeposit()
+	deposit.BrokerSlug = "broker"
+	deposit.Date = &date
+	deposit.DueDate = &date
+	deposit.FixedInterestRate = 10
+	deposit.PortfolioSlug = "default"
+	deposit.Price = wallet.NewDecimalFromInt(100)
+	deposit.Shares = wallet.NewDecimalFromInt(1)
+	deposit.Symbol = "CDB"
+	deposit.Type = "purchase"
+	if _, err := session.Create(deposit); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func depositPosition(t *testing.T, session *documentDB, asOf time.Time) wallet.Position {
+	t.Helper()
+	portfolio := &wallet.Portfolio{Slug: "default"}
+	if err := session.GetPortfolioData(portfolio, asOf); err != nil {
+		t.Fatal(err)
+	}
+	positions := portfolio.Items[wallet.CertificateOfDepositItemType]
+	if len(positions) != 1 {
+		t.Fatalf("expected a position, got %+v", portfolio.Items)
+	}
+	return positions[0]
+}
+
+func TestMaterializedTotals(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, session *documentDB) {
+		createDeposit(t, session, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC))
+		createDeposit(t, session, time.Now().UTC().AddDate(1, 0, 0))
+
+		// Current reads take the stored totals instead of recomputing them.
+		u := bson.M{"$set": bson.M{"costBasis": wallet.NewDecimalFromInt(42)}}
+		if _, err := session.collection.UpdateMany(positionsCollection, bson.M{}, u); err != nil {
+			t.Fatal(err)
+		}
+		if position := depositPosition(t, session, time.Time{}); position.CostBasis.String() != "42" || position.Shares.String() != "2" {
+			t.Fatalf("expected the stored totals, got %s for %s shares", position.CostBasis, position.Shares)
+		}
+
+		// Any other date, even a future one, leaves out later operations.
+		tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+		if position := depositPosition(t, session, tomorrow); position.CostBasis.String() != "100" || position.Shares.String() != "1" {
+			t.Fatalf("expected only the past operation, got %s for %s shares", position.CostBasis, position.Shares)
+		}
+	})
+}
+
+// failingPositions is a collection unable to save positions.
+type failingPositions struct {
+	Collection
+}
+
+func (f failingPositions) ReplaceOne(c string, q bson.M, d interface{}) (*UpdateResult, error) {
+	if c == positionsCollection {
+		return nil, errors.New("positions unavailable")
+	}
+	return f.Collection.ReplaceOne(c, q, d)
+}
+
+func (f failingPositions) Transaction(fn func(Collection) error) error {
+	return f.Collection.Transaction(func(c Collection) error {
+		return fn(failingPositions{c})
+	})
+}
+
+func TestPositionRefreshFailure(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, session *documentDB) {
+		failing := &documentDB{collection: failingPositions{session.collection}}
+		deposit := wallet.NewCertificateOfDeposit()
+		deposit.PortfolioSlug = "default"
+		deposit.Symbol = "CDB"
+		if _, err := failing.Create(deposit); err == nil {
+			t.Fatal("expected the create to fail without refreshing its position")
+		}
+		if n, err := session.Count(operationsCollection); err != nil || n != 0 {
+			t.Fatalf("expected the create to be rolled back, got %d operations (%v)", n, err)
+		}
+	})
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const positionsCollection = "positions"
+
+// positionKey identifies the position of a symbol in a portfolio.
+type positionKey struct {
+	ItemType      string `bson:"itemType"`
+	PortfolioSlug string `bson:"portfolioSlug"`
+	Symbol        string `bson:"symbol"`
+}
+
+func (k positionKey) id() string {
+	return k.PortfolioSlug + "/" + k.ItemType + "/" + k.Symbol
+}
+
+func operationPositionKey(doc bson.M) (positionKey, bool) {
+	itemType, _ := doc["itemType"].(string)
+	portfolioSlug, _ := doc[PortfolioSlugField].(string)
+	symbol, _ := doc["symbol"].(string)
+	key := positionKey{ItemType: itemType, PortfolioSlug: portfolioSlug, Symbol: symbol}
+	return key, itemType != "" && portfolioSlug != "" && symbol != ""
+}
+
+// storedPosition is a position materialized in the positions collection,
+// with every operation of the symbol in the portfolio. Quotes are not
+// stored: they are added when read.
+type storedPosition struct {
+	ID            string         `bson:"_id"`
+	AveragePrice  wallet.Decimal `bson:"averagePrice"`
+	Commission    wallet.Decimal `bson:"commission"`
+	CostBasis     wallet.Decimal `bson:"costBasis"`
+	ItemType      string         `bson:"itemType"`
+	Operations    []bson.Raw     `bson:"operations"`
+	PortfolioSlug string         `bson:"portfolioSlug"`
+	Shares        wallet.Decimal `bson:"shares"`
+	Symbol        string         `bson:"symbol"`
+	UpdatedAt     time.Time      `bson:"updatedAt"`
+}
+
+// position returns the position of g with its totals, taken from the
+// materialized position when there is one and else recomputed from the
+// operations.
+func (g operationGroup) position(position wallet.Position) wallet.Position {
+	position.Symbol = g.ID.Symbol
+	position.ItemType = g.ID.ItemType
+	position.Operations = g.operationsList()
+	if g.materialized == nil {
+		position.Recalculate()
+		return position
+	}
+	position.AveragePrice = wallet.NewMoney(g.materialized.AveragePrice)
+	position.Commission = wallet.NewMoney(g.materialized.Commission)
+	position.CostBasis = wallet.NewMoney(g.materialized.CostBasis)
+	position.Shares = g.materialized.Shares
+	position.Revalue()
+	return position
+}
+
+// stored returns the position of the operations of g as materialized.
+func (g operationGroup) stored() *storedPosition {
+	position := wallet.Position{
+		ItemType:   g.ID.ItemType,
+		Operations: g.operationsList(),
+		Symbol:     g.ID.Symbol,
+	}
+	position.Recalculate()
+	return &storedPosition{
+		ID:            g.ID.id(),
+		AveragePrice:  position.AveragePrice.Decimal,
+		Commission:    position.Commission.Decimal,
+		CostBasis:     position.CostBasis.Decimal,
+		ItemType:      g.ID.ItemType,
+		Operations:    g.Operations,
+		PortfolioSlug: g.ID.PortfolioSlug,
+		Shares:        position.Shares,
+		Symbol:        g.ID.Symbol,
+		UpdatedAt:     time.Now().UTC(),
+	}
+}
+
+func (m *documentDB) savePosition(g operationGroup) error {
+	stored := g.stored()
+	_, err := m.collection.ReplaceOne(positionsCollection, bson.M{"_id": stored.ID}, stored)
+	return err
+}
+
+// refreshPosition recomputes the materialized position of key from its
+// operations.
+func (m *documentDB) refreshPosition(key positionKey) error {
+	m.logger().Debugf("[DB] Refreshing position %s", key.id())
+	query := active(bson.M{
+		"itemType":         key.ItemType,
+		PortfolioSlugField: key.PortfolioSlug,
+		"symbol":           key.Symbol,
+	})
+	results, err := m.collection.FindAll(operationsCollection, query, FindSorted("date", 1))
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		_, err := m.collection.DeleteOne(positionsCollection, bson.M{"_id": key.id()})
+		return err
+	}
+	g := operationGroup{ID: key}
+	for _, result := range results {
+		raw, err := bson.Marshal(result)
+		if err != nil {
+			return err
+		}
+		g.Operations = append(g.Operations, raw)
+	}
+	return m.savePosition(g)
+}
+
+// changed records a change in the history and refreshes the positions
+// affected by it. Changes run in a transaction, so failing to refresh a
+// position rolls the change back rather than leaving the position stale.
+func (m *documentDB) changed(collectionName, action string, before, after bson.M) error {
+	if err := m.recordHistory(collectionName, action, before, after); err != nil {
+		return err
+	}
+	if collectionName != operationsCollection {
+		return nil
+	}
+	refreshed := map[positionKey]bool{}
+	for _, doc := range []bson.M{before, after} {
+		key, ok := operationPositionKey(doc)
+		if !ok || refreshed[key] {
+			continue
+		}
+		refreshed[key] = true
+		if err := m.refreshPosition(key); err != nil {
+			m.logger().Errorf("[DB] Error on refresh position %s: %s", key.id(), err)
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildPositions recomputes every materialized position from the
+// operations, returning how many positions were written.
+func (m *documentDB) RebuildPositions() (int64, error) {
+	m.logger().Info("[DB] Rebuilding positions")
+	groups, err := m.getOperationGroups(active(bson.M{}))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := m.collection.DeleteMany(positionsCollection, bson.M{}); err != nil {
+		return 0, err
+	}
+	for _, g := range groups {
+		if err := m.savePosition(g); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(groups)), nil
+}
+
+// CheckPositions returns the IDs of the materialized positions that do not
+// match their operations, including missing and orphaned ones.
+func (m *documentDB) CheckPositions() ([]string, error) {
+	m.logger().Debug("[DB] CheckPositions")
+	groups, err := m.getOperationGroups(active(bson.M{}))
+	if err != nil {
+		return nil, err
+	}
+	results, err := m.collection.FindAll(positionsCollection, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	stored := map[string]storedPosition{}
+	for _, result := range results {
+		position := storedPosition{}
+		if err := decodeDocument(result, &position); err != nil {
+			return nil, err
+		}
+		stored[position.ID] = position
+	}
+	drifted := []string{}
+	for _, g := range groups {
+		expected := g.stored()
+		actual, ok := stored[expected.ID]
+		delete(stored, expected.ID)
+		if !ok || len(actual.Operations) != len(expected.Operations) ||
+			actual.Shares.Cmp(expected.Shares) != 0 ||
+			actual.CostBasis.Cmp(expected.CostBasis) != 0 {
+			drifted = append(drifted, expected.ID)
+		}
+	}
+	for id := range stored {
+		drifted = append(drifted, id)
+	}
+	sort.Strings(drifted)
+	return drifted, nil
+}
+
+// getMaterializedGroups reads the positions of portfolioSlugs with their
+// stored totals, so they are not recomputed from the operations.
+func (m *documentDB) getMaterializedGroups(portfolioSlugs []string) ([]operationGroup, error) {
+	m.logger().Debug("[DB] getMaterializedGroups")
+	query := bson.M{PortfolioSlugField: bson.M{"$in": portfolioSlugs}}
+	opts := &FindOptions{Sort: []SortField{{Field: "itemType", Order: 1}, {Field: "symbol", Order: 1}}}
+	results, err := m.collection.FindAll(positionsCollection, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	groups := []operationGroup{}
+	for _, result := range results {
+		stored := storedPosition{}
+		if err := decodeDocument(result, &stored); err != nil {
+			return nil, err
+		}
+		key := positionKey{ItemType: stored.ItemType, PortfolioSlug: stored.PortfolioSlug, Symbol: stored.Symbol}
+		groups = append(groups, operationGroup{ID: key, Operations: stored.Operations, materialized: &stored})
+	}
+	return groups, nil
+}
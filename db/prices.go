@@ -0,0 +1,214 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/marketdata"
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const pricesCollection = "prices"
+
+// day returns the calendar day of t, in its location, as midnight UTC,
+// the date of a price.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// priceID keys prices by item type, symbol and day, so saving a price
+// replaces the one of the same day.
+func priceID(p wallet.Price) string {
+	return p.ItemType + "/" + p.Symbol + "/" + p.Date.Format("2006-01-02")
+}
+
+// SavePrices stores prices, replacing those of the same symbol and day.
+func (m *documentDB) SavePrices(prices []wallet.Price) (int64, error) {
+	m.logger().Debugf("[DB] SavePrices %d", len(prices))
+	var saved int64
+	for _, p := range prices {
+		p.Date = day(p.Date)
+		doc, err := toDocument(p)
+		if err != nil {
+			return saved, err
+		}
+		doc["_id"] = priceID(p)
+		if _, err := m.collection.ReplaceOne(pricesCollection, bson.M{"_id": doc["_id"]}, doc); err != nil {
+			return saved, err
+		}
+		saved++
+	}
+	return saved, nil
+}
+
+func decodePrices(results []bson.M) ([]wallet.Price, error) {
+	prices := []wallet.Price{}
+	for _, result := range results {
+		p := wallet.Price{}
+		if err := decodeDocument(result, &p); err != nil {
+			return nil, err
+		}
+		prices = append(prices, p)
+	}
+	return prices, nil
+}
+
+// GetPrices returns the prices of symbol between from and to, inclusive,
+// sorted by date. Zero times leave the range open.
+func (m *documentDB) GetPrices(itemType, symbol string, from, to time.Time) ([]wallet.Price, error) {
+	m.logger().Debugf("[DB] GetPrices %s/%s", itemType, symbol)
+	dateRange := bson.M{}
+	if !from.IsZero() {
+		dateRange["$gte"] = day(from)
+	}
+	if !to.IsZero() {
+		dateRange["$lte"] = day(to)
+	}
+	q := bson.M{"itemType": itemType, "symbol": symbol}
+	if len(dateRange) > 0 {
+		q["date"] = dateRange
+	}
+	results, err := m.collection.FindAll(pricesCollection, q, FindSorted("date", 1))
+	if err != nil {
+		return nil, err
+	}
+	return decodePrices(results)
+}
+
+// GetPriceAt returns the last price of symbol on or before date, or nil
+// when there is none.
+func (m *documentDB) GetPriceAt(itemType, symbol string, date time.Time) (*wallet.Price, error) {
+	q := bson.M{"itemType": itemType, "symbol": symbol, "date": bson.M{"$lte": date}}
+	results, err := m.collection.FindAll(pricesCollection, q, FindSorted("date", -1).SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+	prices, err := decodePrices(results)
+	if err != nil || len(prices) == 0 {
+		return nil, err
+	}
+	return &prices[0], nil
+}
+
+// getPricesAt values symbols with their stored prices at date, keyed by
+// symbol. Symbols without a price are missing from the result.
+func (m *documentDB) getPricesAt(itemType string, symbols []string, date time.Time) map[string]wallet.Position {
+	positions := map[string]wallet.Position{}
+	for _, symbol := range symbols {
+		p, err := m.GetPriceAt(itemType, symbol, date)
+		if err != nil {
+			m.logger().Warnf("[DB] Error on get %s price at %s: %v", symbol, date, err)
+			continue
+		}
+		if p == nil {
+			continue
+		}
+		quotedAt := p.Date
+		positions[symbol] = wallet.Position{
+			LastPrice: p.Price,
+			QuotedAt:  &quotedAt,
+			Symbol:    symbol,
+		}
+	}
+	return positions
+}
+
+// ErrNoPriceHistory is returned by BackfillPrices when no market data
+// provider has the history of any symbol with operations.
+var ErrNoPriceHistory = errors.New("no market data provider configured has price history")
+
+// BackfillPrices retrieves from the market data providers the prices of
+// every symbol with operations, from its first operation until to, and
+// saves those of the days without a stored price, filling every gap. It
+// returns how many prices were saved.
+func (m *documentDB) BackfillPrices(to time.Time) (int64, error) {
+	m.logger().Info("[DB] Backfilling prices")
+	operations, err := m.collection.FindAll(operationsCollection, active(bson.M{}), FindSorted("date", 1))
+	if err != nil {
+		return 0, err
+	}
+	firstDates := map[positionKey]time.Time{}
+	keys := []positionKey{}
+	for _, doc := range operations {
+		key, ok := operationPositionKey(doc)
+		date, isDate := doc["date"].(time.Time)
+		if dt, ok := doc["date"].(interface{ Time() time.Time }); ok {
+			date, isDate = dt.Time(), true
+		}
+		if !ok || !isDate {
+			continue
+		}
+		// Prices do not depend on the portfolio.
+		key.PortfolioSlug = ""
+		if _, seen := firstDates[key]; !seen {
+			firstDates[key] = date
+			keys = append(keys, key)
+		}
+	}
+
+	var saved int64
+	supported := false
+	failed := []string{}
+	for _, key := range keys {
+		if err := m.context().Err(); err != nil {
+			return saved, err
+		}
+		from := day(firstDates[key])
+		if from.After(to) {
+			continue
+		}
+		history, err := marketdata.GetHistory(m.context(), key.ItemType, key.Symbol, from, to)
+		if errors.Is(err, marketdata.ErrNotSupported) {
+			m.logger().Debugf("[DB] No price history of %s: %v", key.Symbol, err)
+			continue
+		}
+		supported = true
+		if errors.Is(err, marketdata.ErrNotFound) {
+			m.logger().Debugf("[DB] No price history of %s: %v", key.Symbol, err)
+			continue
+		}
+		if err != nil {
+			m.logger().Warnf("[DB] Error on get %s price history: %v", key.Symbol, err)
+			failed = append(failed, key.Symbol)
+			continue
+		}
+		stored, err := m.GetPrices(key.ItemType, key.Symbol, from, to)
+		if err != nil {
+			return saved, err
+		}
+		storedDays := map[time.Time]bool{}
+		for _, p := range stored {
+			storedDays[day(p.Date)] = true
+		}
+		prices := []wallet.Price{}
+		for _, h := range history {
+			if storedDays[day(h.Date)] {
+				continue
+			}
+			prices = append(prices, wallet.Price{
+				Date:     h.Date,
+				ItemType: key.ItemType,
+				Price:    h.Price,
+				Symbol:   key.Symbol,
+			})
+		}
+		n, err := m.SavePrices(prices)
+		saved += n
+		if err != nil {
+			return saved, err
+		}
+	}
+	if len(keys) > 0 && !supported {
+		return saved, ErrNoPriceHistory
+	}
+	if len(failed) > 0 {
+		return saved, fmt.Errorf("error on get the price history of %s", strings.Join(failed, ", "))
+	}
+	return saved, nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/marketdata"
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+)
+
+// noHistory is a market data provider without price history.
+type noHistory struct {
+	marketdata.Provider
+}
+
+func (noHistory) History(ctx context.Context, itemType, symbol string, from, to time.Time) ([]marketdata.Price, error) {
+	return nil, marketdata.ErrNotSupported
+}
+
+func setMarketData(t *testing.T, provider marketdata.Provider) {
+	previous := marketdata.Default
+	marketdata.Default = provider
+	t.Cleanup(func() { marketdata.Default = previous })
+}
+
+func TestBackfillPrices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.csv")
+	content := "itemType,symbol,date,price\nstocks,PETR4,2020-01-02,29.90\nstocks,PETR4,2020-01-03,30.10\nstocks,PETR4,2020-01-06,30.50\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	forEachDriver(t, func(t *testing.T, session *documentDB) {
+		first := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+		stock := wallet.NewStock()
+		stock.BrokerSlug = "broker"
+		stock.Date = &first
+		stock.PortfolioSlug = "default"
+		stock.Price = wallet.NewDecimalFromInt(30)
+		stock.Shares = wallet.NewDecimalFromInt(10)
+		stock.Symbol = "PETR4"
+		stock.Type = "purchase"
+		if _, err := session.Create(stock); err != nil {
+			t.Fatal(err)
+		}
+		imported := wallet.Price{Date: first.AddDate(0, 0, 1), ItemType: "stocks", Price: wallet.NewDecimalFromInt(31), Symbol: "PETR4"}
+		if _, err := session.SavePrices([]wallet.Price{imported}); err != nil {
+			t.Fatal(err)
+		}
+
+		setMarketData(t, noHistory{})
+		if _, err := session.BackfillPrices(first.AddDate(0, 0, 4)); !errors.Is(err, ErrNoPriceHistory) {
+			t.Fatalf("expected no price history, got %v", err)
+		}
+
+		// The days before and after the stored price are filled, keeping it.
+		setMarketData(t, marketdata.NewFile(path))
+		saved, err := session.BackfillPrices(first.AddDate(0, 0, 4))
+		if err != nil || saved != 2 {
+			t.Fatalf("expected 2 prices saved, got %d (%v)", saved, err)
+		}
+		prices, err := session.GetPrices("stocks", "PETR4", time.Time{}, time.Time{})
+		if err != nil || len(prices) != 3 || prices[0].Price.String() != "29.9" || prices[1].Price.String() != "31" {
+			t.Fatalf("unexpected prices %+v (%v)", prices, err)
+		}
+	})
+}
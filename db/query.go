@@ -0,0 +1,574 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// This file evaluates the queries described by Collection in memory, for
+// storage backends that keep BSON documents without understanding them.
+
+// toDocument converts any value marshalable to BSON into a document holding
+// only BSON types, so values compare the same no matter where they came
+// from.
+func toDocument(d interface{}) (bson.M, error) {
+	data, err := bson.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func toList(v interface{}) ([]interface{}, bool) {
+	switch l := v.(type) {
+	case bson.A:
+		return l, true
+	case []interface{}:
+		return l, true
+	case []bson.M:
+		result := make([]interface{}, len(l))
+		for i, item := range l {
+			result[i] = item
+		}
+		return result, true
+	case []string:
+		result := make([]interface{}, len(l))
+		for i, item := range l {
+			result[i] = item
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+func toQuery(v interface{}) (bson.M, bool) {
+	switch q := v.(type) {
+	case bson.M:
+		return q, true
+	case map[string]interface{}:
+		return bson.M(q), true
+	}
+	return nil, false
+}
+
+func isOperatorQuery(q bson.M) bool {
+	for k := range q {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return len(q) > 0
+}
+
+// normalize converts v to a value comparable with compareValues.
+func normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case primitive.DateTime:
+		return n.Time().UTC()
+	case time.Time:
+		return n.UTC()
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(n.String(), 64)
+		if err != nil {
+			return n.String()
+		}
+		return f
+	}
+	return v
+}
+
+// compareValues orders two values of the same kind. ok is false when they
+// can not be ordered.
+func compareValues(a, b interface{}) (result int, ok bool) {
+	a, b = normalize(a), normalize(b)
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			switch {
+			case x.Before(y):
+				return -1, true
+			case x.After(y):
+				return 1, true
+			}
+			return 0, true
+		}
+	case primitive.ObjectID:
+		if y, ok := b.(primitive.ObjectID); ok {
+			return bytes.Compare(x[:], y[:]), true
+		}
+	}
+	return 0, false
+}
+
+func equalValues(a, b interface{}) bool {
+	if result, ok := compareValues(a, b); ok {
+		return result == 0
+	}
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// equalOrContains matches like MongoDB equality: an array field matches when
+// any of its elements is equal to the value.
+func equalOrContains(field, value interface{}) bool {
+	if equalValues(field, value) {
+		return true
+	}
+	if items, ok := toList(field); ok {
+		for _, item := range items {
+			if equalValues(item, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesOperator(doc bson.M, field, op string, arg interface{}) (bool, error) {
+	value, exists := doc[field]
+	switch op {
+	case "$exists":
+		want, _ := arg.(bool)
+		return exists == want, nil
+	case "$eq":
+		return exists && equalOrContains(value, arg), nil
+	case "$ne":
+		return !exists || !equalOrContains(value, arg), nil
+	case "$in":
+		items, ok := toList(arg)
+		if !ok {
+			return false, fmt.Errorf("$in expects an array, got %T", arg)
+		}
+		for _, item := range items {
+			if exists && equalOrContains(value, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$lt", "$lte", "$gt", "$gte":
+		if !exists {
+			return false, nil
+		}
+		result, ok := compareValues(value, arg)
+		if !ok {
+			return false, nil
+		}
+		switch op {
+		case "$lt":
+			return result < 0, nil
+		case "$lte":
+			return result <= 0, nil
+		case "$gt":
+			return result > 0, nil
+		}
+		return result >= 0, nil
+	}
+	return false, fmt.Errorf("unsupported query operator %s", op)
+}
+
+// matches reports whether doc satisfies q.
+func matches(doc bson.M, q bson.M) (bool, error) {
+	for k, v := range q {
+		switch k {
+		case "$or", "$and":
+			items, ok := toList(v)
+			if !ok {
+				return false, fmt.Errorf("%s expects an array, got %T", k, v)
+			}
+			any := false
+			for _, item := range items {
+				sub, ok := toQuery(item)
+				if !ok {
+					return false, fmt.Errorf("%s expects documents, got %T", k, item)
+				}
+				match, err := matches(doc, sub)
+				if err != nil {
+					return false, err
+				}
+				if k == "$and" && !match {
+					return false, nil
+				}
+				any = any || match
+			}
+			if k == "$or" && !any {
+				return false, nil
+			}
+		default:
+			if sub, ok := toQuery(v); ok && isOperatorQuery(sub) {
+				for op, arg := range sub {
+					match, err := matchesOperator(doc, k, op, arg)
+					if err != nil || !match {
+						return false, err
+					}
+				}
+				continue
+			}
+			value, exists := doc[k]
+			if v == nil {
+				if exists && value != nil {
+					return false, nil
+				}
+				continue
+			}
+			if !exists || !equalOrContains(value, v) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// applyUpdate returns doc modified by the $set and $unset operators in u.
+func applyUpdate(doc bson.M, u bson.M) (bson.M, error) {
+	result := bson.M{}
+	for k, v := range doc {
+		result[k] = v
+	}
+	for op, arg := range u {
+		fields, ok := toQuery(arg)
+		if !ok {
+			set, err := toDocument(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%s expects a document: %v", op, err)
+			}
+			fields = set
+		}
+		switch op {
+		case "$set":
+			for k, v := range fields {
+				result[k] = v
+			}
+		case "$unset":
+			for k := range fields {
+				delete(result, k)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported update operator %s", op)
+		}
+	}
+	return toDocument(result)
+}
+
+// replaceDocument returns d as the replacement of the first document in
+// docs matching q, keeping its _id, and whether it is a new document.
+func replaceDocument(docs []bson.M, q bson.M, d interface{}) (bson.M, bool, error) {
+	doc, err := toDocument(d)
+	if err != nil {
+		return nil, false, err
+	}
+	targets, err := findDocuments(docs, q, &FindOptions{Limit: 1})
+	if err != nil {
+		return nil, false, err
+	}
+	if len(targets) != 0 {
+		doc["_id"] = targets[0]["_id"]
+		return doc, false, nil
+	}
+	if _, ok := doc["_id"]; !ok {
+		if id, ok := q["_id"]; ok {
+			doc["_id"] = id
+		} else {
+			doc["_id"] = primitive.NewObjectID()
+		}
+	}
+	return doc, true, nil
+}
+
+// sortDocuments sorts docs in place. Missing values sort first, like nulls
+// in MongoDB.
+func sortDocuments(docs []bson.M, fields []SortField) {
+	if len(fields) == 0 {
+		return
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, f := range fields {
+			a, aExists := docs[i][f.Field]
+			b, bExists := docs[j][f.Field]
+			var result int
+			switch {
+			case !aExists && !bExists:
+				continue
+			case !aExists:
+				result = -1
+			case !bExists:
+				result = 1
+			default:
+				result, _ = compareValues(a, b)
+			}
+			if result != 0 {
+				return result*f.Order < 0
+			}
+		}
+		return false
+	})
+}
+
+// findDocuments filters, sorts and limits docs.
+func findDocuments(docs []bson.M, q bson.M, o ...*FindOptions) ([]bson.M, error) {
+	results := []bson.M{}
+	for _, doc := range docs {
+		match, err := matches(doc, q)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			results = append(results, doc)
+		}
+	}
+	opts := mergeFindOptions(o...)
+	sortDocuments(results, opts.Sort)
+	if opts.Limit > 0 && int64(len(results)) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results, nil
+}
+
+// distinctValues returns the distinct values of field, flattening arrays.
+func distinctValues(docs []bson.M, field string) []interface{} {
+	values := []interface{}{}
+	add := func(v interface{}) {
+		for _, existing := range values {
+			if equalValues(existing, v) {
+				return
+			}
+		}
+		values = append(values, v)
+	}
+	for _, doc := range docs {
+		v, exists := doc[field]
+		if !exists {
+			continue
+		}
+		if items, ok := toList(v); ok {
+			for _, item := range items {
+				add(item)
+			}
+			continue
+		}
+		add(v)
+	}
+	return values
+}
+
+func equalDocuments(a, b bson.M) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if !equalValues(v, b[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkUnique makes sure doc does not repeat the values of the fields of a
+// unique index, given by its key, of any document in others with a different
+// _id. As in MongoDB, missing fields compare as null, but documents missing
+// every field of an index are not checked.
+func checkUnique(doc bson.M, others []bson.M, keys []string) error {
+	for _, key := range keys {
+		fields := strings.Split(key, ",")
+		if !hasAnyField(doc, fields) {
+			continue
+		}
+		for _, other := range others {
+			if equalValues(other["_id"], doc["_id"]) {
+				continue
+			}
+			if sameFieldValues(doc, other, fields) {
+				return fmt.Errorf("%w: %s '%v'", ErrDuplicateKey, fields[0], doc[fields[0]])
+			}
+		}
+	}
+	return nil
+}
+
+// removeIndexKey returns keys without key.
+func removeIndexKey(keys []string, key string) []string {
+	result := []string{}
+	for _, k := range keys {
+		if k != key {
+			result = append(result, k)
+		}
+	}
+	return result
+}
+
+func hasAnyField(doc bson.M, fields []string) bool {
+	for _, field := range fields {
+		if doc[field] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func sameFieldValues(a, b bson.M, fields []string) bool {
+	for _, field := range fields {
+		if a[field] == nil || b[field] == nil {
+			if (a[field] == nil) != (b[field] == nil) {
+				return false
+			}
+			continue
+		}
+		if !equalValues(a[field], b[field]) {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeDocument fills r with doc, like decoding a MongoDB result.
+func decodeDocument(doc bson.M, r interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, r)
+}
+
+func documentKey(id interface{}) string {
+	if objectId, ok := id.(primitive.ObjectID); ok {
+		return objectId.Hex()
+	}
+	return fmt.Sprint(id)
+}
+
+// fieldValue resolves an aggregation expression: "$$ROOT" is the whole
+// document, "$field" a top-level field and anything else a literal.
+func fieldValue(doc bson.M, expr interface{}) interface{} {
+	path, ok := expr.(string)
+	if !ok || !strings.HasPrefix(path, "$") {
+		return expr
+	}
+	if path == "$$ROOT" {
+		return doc
+	}
+	return doc[strings.TrimPrefix(path, "$")]
+}
+
+// groupKey evaluates the _id expression of a $group stage, returning the
+// value and a key identifying it.
+func groupKey(doc bson.M, expr interface{}) (interface{}, string) {
+	fields, ok := toQuery(expr)
+	if !ok {
+		value := fieldValue(doc, expr)
+		return value, fmt.Sprintf("%#v", normalize(value))
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	value := bson.M{}
+	key := ""
+	for _, name := range names {
+		value[name] = fieldValue(doc, fields[name])
+		key += fmt.Sprintf("%s=%#v;", name, normalize(value[name]))
+	}
+	return value, key
+}
+
+func groupDocuments(docs []bson.M, spec bson.M) ([]bson.M, error) {
+	groups := []bson.M{}
+	index := map[string]bson.M{}
+	for _, doc := range docs {
+		id, key := groupKey(doc, spec["_id"])
+		group, exists := index[key]
+		if !exists {
+			group = bson.M{"_id": id}
+			index[key] = group
+			groups = append(groups, group)
+		}
+		for field, acc := range spec {
+			if field == "_id" {
+				continue
+			}
+			op, ok := toQuery(acc)
+			if !ok || len(op) != 1 || op["$push"] == nil {
+				return nil, fmt.Errorf("unsupported accumulator for %s: %v", field, acc)
+			}
+			items, _ := group[field].(bson.A)
+			group[field] = append(items, fieldValue(doc, op["$push"]))
+		}
+	}
+	return groups, nil
+}
+
+// aggregateDocuments runs an aggregation pipeline over docs.
+func aggregateDocuments(docs []bson.M, pipeline []bson.M) ([]bson.M, error) {
+	for _, stage := range pipeline {
+		if len(stage) != 1 {
+			return nil, fmt.Errorf("pipeline stages must have one operator, got %v", stage)
+		}
+		for op, arg := range stage {
+			var err error
+			switch op {
+			case "$match":
+				q, ok := toQuery(arg)
+				if !ok {
+					return nil, fmt.Errorf("$match expects a document, got %T", arg)
+				}
+				docs, err = findDocuments(docs, q)
+			case "$sort":
+				spec, ok := arg.(bson.D)
+				if !ok {
+					return nil, fmt.Errorf("$sort expects an ordered document, got %T", arg)
+				}
+				fields := []SortField{}
+				for _, e := range spec {
+					order, _ := e.Value.(int)
+					fields = append(fields, SortField{Field: e.Key, Order: order})
+				}
+				sortDocuments(docs, fields)
+			case "$group":
+				spec, ok := toQuery(arg)
+				if !ok {
+					return nil, fmt.Errorf("$group expects a document, got %T", arg)
+				}
+				docs, err = groupDocuments(docs, spec)
+			default:
+				return nil, fmt.Errorf("unsupported pipeline stage %s", op)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return docs, nil
+}
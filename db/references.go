@@ -0,0 +1,87 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Operation fields that reference brokers and portfolios by slug.
+const (
+	BrokerSlugField    = "brokerSlug"
+	PortfolioSlugField = "portfolioSlug"
+)
+
+func (m *documentDB) CountOperationsByReference(field, slug string) (int64, error) {
+	m.logger().Debugf("[DB] CountOperationsByReference %s=%s", field, slug)
+	return m.collection.CountDocuments(operationsCollection, active(bson.M{field: slug}))
+}
+
+func (m *documentDB) DeleteOperationsByReference(field, slug string) (*DeleteResult, error) {
+	m.logger().Debugf("[DB] DeleteOperationsByReference %s=%s", field, slug)
+	var result *DeleteResult
+	err := m.inTransaction(func(session *documentDB) error {
+		var err error
+		result, err = session.deleteOperationsByReference(field, slug)
+		return err
+	})
+	return result, err
+}
+
+func (m *documentDB) deleteOperationsByReference(field, slug string) (*DeleteResult, error) {
+	q := active(bson.M{field: slug})
+	before, err := m.collection.FindAll(operationsCollection, q)
+	if err != nil {
+		return nil, err
+	}
+	u := bson.M{"$set": bson.M{deletedAtField: time.Now().UTC()}}
+	result, err := m.collection.UpdateMany(operationsCollection, q, u)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range before {
+		if err := m.changed(operationsCollection, wallet.HistoryDelete, doc, nil); err != nil {
+			return nil, err
+		}
+	}
+	return &DeleteResult{DeletedCount: result.ModifiedCount}, nil
+}
+
+func (m *documentDB) ReassignOperations(field, from, to string) (*UpdateResult, error) {
+	m.logger().Debugf("[DB] ReassignOperations %s: %s -> %s", field, from, to)
+	var result *UpdateResult
+	err := m.inTransaction(func(session *documentDB) error {
+		var err error
+		result, err = session.reassignOperations(field, from, to)
+		return err
+	})
+	return result, err
+}
+
+func (m *documentDB) reassignOperations(field, from, to string) (*UpdateResult, error) {
+	f := active(bson.M{field: from})
+	before, err := m.collection.FindAll(operationsCollection, f)
+	if err != nil {
+		return nil, err
+	}
+	u := bson.M{"$set": bson.M{field: to}}
+	result, err := m.collection.UpdateMany(operationsCollection, f, u)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range before {
+		after := bson.M{}
+		q := bson.M{"_id": doc["_id"]}
+		if err := m.collection.FindOne(operationsCollection, q, &after); err != nil {
+			m.logger().Errorf("[DB] Error on retrieve reassigned operation: %s", err)
+		}
+		if err := m.changed(operationsCollection, wallet.HistoryUpdate, doc, after); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,437 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver
+)
+
+// sqliteIndexesTable keeps the unique indexes, by key, which are enforced by
+// sqliteCollection rather than by SQLite.
+const sqliteIndexesTable = "_indexes"
+
+// sqliteStore keeps every collection in a table of BSON documents, keyed by
+// _id. Queries other than by _id are evaluated in memory, which is fine for
+// the size of a personal wallet.
+type sqliteStore struct {
+	db *sql.DB
+	// mu serializes writes, so unique indexes can be checked before writing.
+	mu       sync.Mutex
+	indexes  map[string][]string
+	tablesMu sync.Mutex
+	tables   map[string]bool
+}
+
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type sqliteCollection struct {
+	ctx   context.Context
+	exec  sqlExecutor
+	inTx  bool
+	store *sqliteStore
+}
+
+func (m *sqliteCollection) context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+func (m *sqliteCollection) logger() *log.Entry {
+	return log.WithContext(m.context())
+}
+
+func (m *sqliteCollection) WithContext(ctx context.Context) Collection {
+	return &sqliteCollection{ctx: ctx, exec: m.exec, inTx: m.inTx, store: m.store}
+}
+
+func (m *sqliteCollection) Close() error {
+	m.logger().Debug("[Collection] Close")
+	return m.store.db.Close()
+}
+
+func quoteTable(c string) string {
+	return `"` + strings.ReplaceAll(c, `"`, `""`) + `"`
+}
+
+func (m *sqliteCollection) ensureTable(c string) error {
+	m.store.tablesMu.Lock()
+	created := m.store.tables[c]
+	m.store.tablesMu.Unlock()
+	if created {
+		return nil
+	}
+	q := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id TEXT PRIMARY KEY, doc BLOB NOT NULL)", quoteTable(c))
+	if _, err := m.exec.ExecContext(m.context(), q); err != nil {
+		return err
+	}
+	// Tables created inside a transaction may still be rolled back.
+	if !m.inTx {
+		m.store.tablesMu.Lock()
+		m.store.tables[c] = true
+		m.store.tablesMu.Unlock()
+	}
+	return nil
+}
+
+func (m *sqliteCollection) lock() func() {
+	if m.inTx {
+		return func() {}
+	}
+	m.store.mu.Lock()
+	return m.store.mu.Unlock
+}
+
+// load returns every document of c.
+func (m *sqliteCollection) load(c string) ([]bson.M, error) {
+	return m.query(c, "")
+}
+
+// find returns the documents of c matching q. Queries by _id read a single
+// row through the primary key, any other query reads the whole table.
+func (m *sqliteCollection) find(c string, q bson.M, o ...*FindOptions) ([]bson.M, error) {
+	var docs []bson.M
+	var err error
+	switch id := q["_id"].(type) {
+	case nil, bson.M, map[string]interface{}:
+		docs, err = m.load(c)
+	default:
+		docs, err = m.query(c, "WHERE id = ?", documentKey(id))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return findDocuments(docs, q, o...)
+}
+
+func (m *sqliteCollection) query(c, where string, args ...interface{}) ([]bson.M, error) {
+	if err := m.ensureTable(c); err != nil {
+		return nil, err
+	}
+	q := fmt.Sprintf("SELECT doc FROM %s %s", quoteTable(c), where)
+	rows, err := m.exec.QueryContext(m.context(), q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	docs := []bson.M{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		doc := bson.M{}
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			m.logger().Errorf("[Collection] Decode: %s", err)
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// checkUnique makes sure doc does not break the unique indexes of c, reading
+// the other documents only when there are any.
+func (m *sqliteCollection) checkUnique(c string, doc bson.M) error {
+	keys := m.store.indexes[c]
+	if len(keys) == 0 {
+		return nil
+	}
+	docs, err := m.load(c)
+	if err != nil {
+		return err
+	}
+	return checkUnique(doc, docs, keys)
+}
+
+func (m *sqliteCollection) save(c string, doc bson.M, insert bool) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	key := documentKey(doc["_id"])
+	if insert {
+		q := fmt.Sprintf("INSERT INTO %s (id, doc) VALUES (?, ?)", quoteTable(c))
+		_, err = m.exec.ExecContext(m.context(), q, key, data)
+		return err
+	}
+	q := fmt.Sprintf("UPDATE %s SET doc = ? WHERE id = ?", quoteTable(c))
+	_, err = m.exec.ExecContext(m.context(), q, data, key)
+	return err
+}
+
+func (m *sqliteCollection) Ping() error {
+	m.logger().Debug("[Collection] Ping")
+	return m.store.db.PingContext(m.context())
+}
+
+func (m *sqliteCollection) InsertOne(c string, d interface{}) (*InsertResult, error) {
+	m.logger().Debug("[Collection] InsertOne")
+	defer m.lock()()
+	doc, err := toDocument(d)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := doc["_id"]; !ok {
+		doc["_id"] = primitive.NewObjectID()
+	}
+	if err := m.ensureTable(c); err != nil {
+		return nil, err
+	}
+	if err := m.checkUnique(c, doc); err != nil {
+		return nil, err
+	}
+	if err := m.save(c, doc, true); err != nil {
+		return nil, err
+	}
+	return &InsertResult{InsertedID: doc["_id"]}, nil
+}
+
+func (m *sqliteCollection) FindAll(c string, q bson.M, o ...*FindOptions) ([]bson.M, error) {
+	m.logger().Debug("[Collection] FindAll")
+	return m.find(c, q, o...)
+}
+
+func (m *sqliteCollection) Aggregate(c string, pipeline []bson.M) ([]bson.M, error) {
+	m.logger().Debug("[Collection] Aggregate")
+	docs, err := m.load(c)
+	if err != nil {
+		return nil, err
+	}
+	return aggregateDocuments(docs, pipeline)
+}
+
+func (m *sqliteCollection) FindOne(c string, q bson.M, r interface{}) error {
+	m.logger().Debug("[Collection] FindOne...")
+	results, err := m.FindAll(c, q, &FindOptions{Limit: 1})
+	if err != nil {
+		m.logger().Errorf("[Collection] Error on retrieve data: %s", err)
+		return err
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	return decodeDocument(results[0], r)
+}
+
+func (m *sqliteCollection) CountDocuments(c string, q bson.M) (int64, error) {
+	m.logger().Debug("[Collection] CountDocuments")
+	results, err := m.FindAll(c, q)
+	return int64(len(results)), err
+}
+
+func (m *sqliteCollection) Distinct(c string, field string, q bson.M) ([]interface{}, error) {
+	m.logger().Debug("[Collection] Distinct")
+	results, err := m.FindAll(c, q)
+	if err != nil {
+		return nil, err
+	}
+	return distinctValues(results, field), nil
+}
+
+func (m *sqliteCollection) update(c string, q, u bson.M, limit int64) (*UpdateResult, error) {
+	defer m.lock()()
+	targets, err := m.find(c, q, &FindOptions{Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	result := &UpdateResult{MatchedCount: int64(len(targets))}
+	for _, doc := range targets {
+		updated, err := applyUpdate(doc, u)
+		if err != nil {
+			return nil, err
+		}
+		if equalDocuments(doc, updated) {
+			continue
+		}
+		if err := m.checkUnique(c, updated); err != nil {
+			return nil, err
+		}
+		if err := m.save(c, updated, false); err != nil {
+			return nil, err
+		}
+		result.ModifiedCount++
+	}
+	return result, nil
+}
+
+func (m *sqliteCollection) ReplaceOne(c string, q bson.M, d interface{}) (*UpdateResult, error) {
+	m.logger().Debug("[Collection] ReplaceOne")
+	defer m.lock()()
+	docs, err := m.find(c, q, &FindOptions{Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	doc, inserted, err := replaceDocument(docs, q, d)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkUnique(c, doc); err != nil {
+		return nil, err
+	}
+	if err := m.save(c, doc, inserted); err != nil {
+		return nil, err
+	}
+	if inserted {
+		return &UpdateResult{UpsertedCount: 1, UpsertedID: doc["_id"]}, nil
+	}
+	return &UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+func (m *sqliteCollection) UpdateOne(c string, q, u bson.M) (*UpdateResult, error) {
+	m.logger().Debug("[Collection] UpdateOne")
+	return m.update(c, q, u, 1)
+}
+
+func (m *sqliteCollection) UpdateMany(c string, q, u bson.M) (*UpdateResult, error) {
+	m.logger().Debug("[Collection] UpdateMany")
+	return m.update(c, q, u, 0)
+}
+
+func (m *sqliteCollection) delete(c string, q bson.M, limit int64) (*DeleteResult, error) {
+	defer m.lock()()
+	targets, err := m.FindAll(c, q, &FindOptions{Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = ?", quoteTable(c))
+	for _, doc := range targets {
+		if _, err := m.exec.ExecContext(m.context(), query, documentKey(doc["_id"])); err != nil {
+			return nil, err
+		}
+	}
+	return &DeleteResult{DeletedCount: int64(len(targets))}, nil
+}
+
+func (m *sqliteCollection) DeleteOne(c string, q bson.M) (*DeleteResult, error) {
+	m.logger().Debug("[Collection] DeleteOne")
+	return m.delete(c, q, 1)
+}
+
+func (m *sqliteCollection) DeleteMany(c string, q bson.M) (*DeleteResult, error) {
+	m.logger().Debug("[Collection] DeleteMany")
+	return m.delete(c, q, 0)
+}
+
+func (m *sqliteCollection) CreateIndex(c string, i Index) error {
+	m.logger().Debug("[Collection] CreateIndex")
+	if !i.Unique {
+		return nil
+	}
+	defer m.lock()()
+	docs, err := m.load(c)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if err := checkUnique(doc, docs, []string{i.key()}); err != nil {
+			return err
+		}
+	}
+	for _, key := range m.store.indexes[c] {
+		if key == i.key() {
+			return nil
+		}
+	}
+	q := fmt.Sprintf("INSERT OR IGNORE INTO %s (collection, field) VALUES (?, ?)", sqliteIndexesTable)
+	if _, err := m.exec.ExecContext(m.context(), q, c, i.key()); err != nil {
+		return err
+	}
+	m.store.indexes[c] = append(m.store.indexes[c], i.key())
+	return nil
+}
+
+func (m *sqliteCollection) DropIndex(c string, i Index) error {
+	m.logger().Debug("[Collection] DropIndex")
+	defer m.lock()()
+	q := fmt.Sprintf("DELETE FROM %s WHERE collection = ? AND field = ?", sqliteIndexesTable)
+	if _, err := m.exec.ExecContext(m.context(), q, c, i.key()); err != nil {
+		return err
+	}
+	m.store.indexes[c] = removeIndexKey(m.store.indexes[c], i.key())
+	return nil
+}
+
+// loadIndexes reads the unique indexes created by previous sessions.
+func (s *sqliteStore) loadIndexes() error {
+	q := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (collection TEXT, field TEXT, PRIMARY KEY (collection, field))", sqliteIndexesTable)
+	if _, err := s.db.Exec(q); err != nil {
+		return err
+	}
+	rows, err := s.db.Query(fmt.Sprintf("SELECT collection, field FROM %s", sqliteIndexesTable))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c, field string
+		if err := rows.Scan(&c, &field); err != nil {
+			return err
+		}
+		s.indexes[c] = append(s.indexes[c], field)
+	}
+	return rows.Err()
+}
+
+func (m *sqliteCollection) Transaction(fn func(Collection) error) error {
+	m.logger().Debug("[Collection] Transaction")
+	if m.inTx {
+		return fn(m)
+	}
+	defer m.lock()()
+	tx, err := m.store.db.BeginTx(m.context(), nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(&sqliteCollection{ctx: m.ctx, exec: tx, inTx: true, store: m.store}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func NewSQLiteSession() (DB, error) {
+	log.Debug("[DB] New SQLite session")
+	path := viper.GetString("sqlite.path")
+	sqlDB, err := sql.Open("sqlite", path)
+	if err != nil {
+		log.Errorf("[DB] Error on open SQLite database: %s", err)
+		return nil, err
+	}
+	// A single connection avoids "database is locked" errors between
+	// concurrent writers.
+	sqlDB.SetMaxOpenConns(1)
+	store := &sqliteStore{
+		db:      sqlDB,
+		indexes: map[string][]string{},
+		tables:  map[string]bool{},
+	}
+	session := &documentDB{
+		collection: instrument("sqlite", &sqliteCollection{exec: sqlDB, store: store}),
+	}
+	if err := sqlDB.Ping(); err != nil {
+		log.Errorf("[DB] Error on open SQLite database: %s", err)
+		return session, err
+	}
+	if err := store.loadIndexes(); err != nil {
+		log.Errorf("[DB] Error on load SQLite indexes: %s", err)
+		return session, err
+	}
+	session.autoMigrate()
+	return session, nil
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// openSQLite returns a migrated session on a new SQLite database removed
+// with the test.
+func openSQLite(t *testing.T) *documentDB {
+	t.Helper()
+	for key, value := range map[string]interface{}{
+		"db.migrate":  true,
+		"sqlite.path": filepath.Join(t.TempDir(), "wallet.db"),
+	} {
+		key, previous := key, viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, previous) })
+	}
+	session, err := NewSQLiteSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session.(*documentDB)
+}
+
+// forEachDriver runs test against a new session of each backend not
+// needing a server.
+func forEachDriver(t *testing.T, test func(t *testing.T, session *documentDB)) {
+	drivers := []struct {
+		name string
+		open func(t *testing.T) *documentDB
+	}{
+		{"memory", func(*testing.T) *documentDB { return NewMemorySession().(*documentDB) }},
+		{"sqlite", openSQLite},
+	}
+	for _, driver := range drivers {
+		t.Run(driver.name, func(t *testing.T) {
+			test(t, driver.open(t))
+		})
+	}
+}
+
+func TestUniqueIndexes(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, session *documentDB) {
+		if _, err := session.Create(&wallet.Broker{Name: "Broker", Slug: "broker"}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := session.Create(&wallet.Broker{Name: "Other", Slug: "broker"})
+		if !errors.Is(err, ErrDuplicateKey) {
+			t.Fatalf("expected a duplicate key error, got %v", err)
+		}
+
+		result, err := session.Create(&wallet.Broker{Name: "Other", Slug: "other"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := documentKey(result.InsertedID)
+		_, err = session.Update(id, &wallet.Broker{Name: "Other", Slug: "broker"})
+		if !errors.Is(err, ErrDuplicateKey) {
+			t.Fatalf("expected a duplicate key error on update, got %v", err)
+		}
+		if n, _ := session.Count(brokersCollection); n != 2 {
+			t.Fatalf("expected 2 brokers, got %d", n)
+		}
+
+		// Deleted documents give their slugs up, but are not restored over
+		// the documents taking them.
+		if _, err := session.Delete(brokersCollection, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := session.Create(&wallet.Broker{Name: "New", Slug: "other"}); err != nil {
+			t.Fatalf("expected the slug of a deleted broker to be reused, got %v", err)
+		}
+		_, err = session.Restore(brokersCollection, id)
+		if !errors.Is(err, ErrDuplicateKey) {
+			t.Fatalf("expected a duplicate key error on restore, got %v", err)
+		}
+	})
+}
+
+func TestReuseTrashedSlugsMigration(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, session *documentDB) {
+		// Simulate the slug index created by older versions.
+		if err := session.collection.DropIndex(brokersCollection, slugIndex); err != nil {
+			t.Fatal(err)
+		}
+		if err := session.collection.CreateIndex(brokersCollection, Index{Field: "slug", Unique: true}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := session.collection.DeleteOne(migrationsCollection, bson.M{"_id": 6}); err != nil {
+			t.Fatal(err)
+		}
+		if count, err := session.Migrate(); err != nil || count != 1 {
+			t.Fatalf("expected 1 migration applied, got %d (%v)", count, err)
+		}
+
+		result, err := session.Create(&wallet.Broker{Name: "Broker", Slug: "broker"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := session.Delete(brokersCollection, documentKey(result.InsertedID)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := session.Create(&wallet.Broker{Name: "Broker", Slug: "broker"}); err != nil {
+			t.Fatalf("expected the slug of a deleted broker to be reused, got %v", err)
+		}
+	})
+}
+
+func TestTransactionRollback(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, session *documentDB) {
+		failure := errors.New("failure")
+		err := session.collection.Transaction(func(c Collection) error {
+			if _, err := c.InsertOne(brokersCollection, &wallet.Broker{Name: "Broker", Slug: "broker"}); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("expected the transaction error, got %v", err)
+		}
+		if n, err := session.collection.CountDocuments(brokersCollection, bson.M{}); err != nil || n != 0 {
+			t.Fatalf("expected the insert to be rolled back, got %d (%v)", n, err)
+		}
+
+		err = session.collection.Transaction(func(c Collection) error {
+			_, err := c.InsertOne(brokersCollection, &wallet.Broker{Name: "Broker", Slug: "broker"})
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := session.collection.CountDocuments(brokersCollection, bson.M{}); n != 1 {
+			t.Fatalf("expected the insert to be committed, got %d", n)
+		}
+	})
+}
+
+func TestFindByID(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, session *documentDB) {
+		result, err := session.Create(&wallet.Broker{Name: "Broker", Slug: "broker"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := result.InsertedID
+		docs, err := session.collection.FindAll(brokersCollection, active(bson.M{"_id": id}))
+		if err != nil || len(docs) != 1 || docs[0]["slug"] != "broker" {
+			t.Fatalf("expected the broker, got %v (%v)", docs, err)
+		}
+		docs, err = session.collection.FindAll(brokersCollection, bson.M{"_id": id, "slug": "other"})
+		if err != nil || len(docs) != 0 {
+			t.Fatalf("expected the other fields to be matched, got %v (%v)", docs, err)
+		}
+		docs, err = session.collection.FindAll(brokersCollection, bson.M{"_id": bson.M{"$in": bson.A{id}}})
+		if err != nil || len(docs) != 1 {
+			t.Fatalf("expected operators on _id to be matched, got %v (%v)", docs, err)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Count returns how many documents of a collection are not in the trash.
+func (m *documentDB) Count(collectionName string) (int64, error) {
+	m.logger().Debugf("[DB] Count %s", collectionName)
+	return m.collection.CountDocuments(collectionName, active(bson.M{}))
+}
+
+// CountOperationsByItemType returns how many operations not in the trash
+// there are of each item type.
+func (m *documentDB) CountOperationsByItemType() (map[string]int64, error) {
+	m.logger().Debug("[DB] CountOperationsByItemType")
+	itemTypes, err := m.collection.Distinct(operationsCollection, "itemType", active(bson.M{}))
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int64{}
+	for _, itemType := range itemTypes {
+		name := fmt.Sprint(itemType)
+		count, err := m.collection.CountDocuments(operationsCollection, active(bson.M{"itemType": name}))
+		if err != nil {
+			return nil, err
+		}
+		counts[name] = count
+	}
+	return counts, nil
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const deletedAtField = "deletedAt"
+
+// TrashCollections lists the collections whose documents are soft deleted.
+var TrashCollections = []string{
+	brokersCollection,
+	portfoliosCollection,
+	operationsCollection,
+}
+
+// active restricts q to documents that are not in the trash.
+func active(q bson.M) bson.M {
+	result := bson.M{deletedAtField: bson.M{"$exists": false}}
+	for k, v := range q {
+		result[k] = v
+	}
+	return result
+}
+
+func trashed(q bson.M) bson.M {
+	result := bson.M{deletedAtField: bson.M{"$exists": true}}
+	for k, v := range q {
+		result[k] = v
+	}
+	return result
+}
+
+// GetTrash returns the deleted documents of each collection in
+// TrashCollections, most recently deleted first.
+func (m *documentDB) GetTrash() (map[string][]wallet.TrashedDocument, error) {
+	m.logger().Debug("[DB] GetTrash")
+	opts := FindSorted(deletedAtField, -1)
+	trash := map[string][]wallet.TrashedDocument{}
+	for _, c := range TrashCollections {
+		results, err := m.collection.FindAll(c, trashed(bson.M{}), opts)
+		if err != nil {
+			return nil, err
+		}
+		trash[c] = []wallet.TrashedDocument{}
+		for _, result := range results {
+			item, err := decodeTrashed(c, result)
+			if err != nil {
+				return nil, err
+			}
+			trash[c] = append(trash[c], item)
+		}
+	}
+	return trash, nil
+}
+
+// decodeTrashed decodes a deleted document into its wallet type, so its
+// values serialize the same way whatever the backend.
+func decodeTrashed(collectionName string, doc bson.M) (wallet.TrashedDocument, error) {
+	item := wallet.TrashedDocument{}
+	switch collectionName {
+	case brokersCollection:
+		item.Document = &wallet.Broker{}
+	case portfoliosCollection:
+		item.Document = &wallet.Portfolio{}
+	default:
+		itemType, _ := doc["itemType"].(string)
+		operation, ok := wallet.NewOperation(itemType).(wallet.Queryable)
+		if !ok {
+			return item, fmt.Errorf("item type '%s' not found", itemType)
+		}
+		item.Document = operation
+	}
+	if err := decodeDocument(doc, item.Document); err != nil {
+		return item, err
+	}
+	deleted := struct {
+		DeletedAt time.Time `bson:"deletedAt"`
+	}{}
+	if err := decodeDocument(doc, &deleted); err != nil {
+		return item, err
+	}
+	item.DeletedAt = deleted.DeletedAt
+	return item, nil
+}
+
+func (m *documentDB) GetTrashed(collectionName, id string, d interface{}) error {
+	m.logger().Debug("[DB] GetTrashed")
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	return m.collection.FindOne(collectionName, trashed(bson.M{"_id": objectId}), d)
+}
+
+// Restore moves a document back from the trash.
+func (m *documentDB) Restore(collectionName, id string) (*UpdateResult, error) {
+	m.logger().Debug("[DB] Restore")
+	var result *UpdateResult
+	err := m.inTransaction(func(session *documentDB) error {
+		var err error
+		result, err = session.restore(collectionName, id)
+		return err
+	})
+	return result, err
+}
+
+func (m *documentDB) restore(collectionName, id string) (*UpdateResult, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	q := trashed(bson.M{"_id": objectId})
+	before := bson.M{}
+	if err := m.collection.FindOne(collectionName, q, &before); err != nil {
+		return nil, err
+	}
+	u := bson.M{"$unset": bson.M{deletedAtField: ""}}
+	result, err := m.collection.UpdateOne(collectionName, q, u)
+	if err != nil {
+		return nil, err
+	}
+	if result.ModifiedCount != 0 {
+		after := bson.M{}
+		if err := m.collection.FindOne(collectionName, active(bson.M{"_id": objectId}), &after); err != nil {
+			m.logger().Errorf("[DB] Error on retrieve restored document: %s", err)
+		}
+		if err := m.changed(collectionName, wallet.HistoryRestore, before, after); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// PurgeTrash permanently removes documents moved to the trash before the
+// given time.
+func (m *documentDB) PurgeTrash(before time.Time) (int64, error) {
+	m.logger().Debugf("[DB] PurgeTrash before %s", before)
+	var purged int64
+	err := m.inTransaction(func(session *documentDB) error {
+		var err error
+		purged, err = session.purgeTrash(before)
+		return err
+	})
+	return purged, err
+}
+
+func (m *documentDB) purgeTrash(before time.Time) (int64, error) {
+	q := bson.M{deletedAtField: bson.M{"$lt": before}}
+	var purged int64
+	for _, c := range TrashCollections {
+		docs, err := m.collection.FindAll(c, q)
+		if err != nil {
+			return purged, err
+		}
+		result, err := m.collection.DeleteMany(c, q)
+		if err != nil {
+			return purged, err
+		}
+		for _, doc := range docs {
+			if err := m.changed(c, wallet.HistoryPurge, doc, nil); err != nil {
+				return purged, err
+			}
+		}
+		purged += result.DeletedCount
+	}
+	return purged, nil
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"context"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// runWorkers runs jobs on at most the configured number of goroutines and
+// waits for them. Jobs not started by the time ctx is done are skipped,
+// and its error is returned.
+func runWorkers(ctx context.Context, jobs []func()) error {
+	workers := viper.GetInt("portfolio.workers")
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(job func()) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			job()
+		}(job)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package db
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestRunWorkers(t *testing.T) {
+	viper.Set("portfolio.workers", 2)
+	t.Cleanup(func() { viper.Set("portfolio.workers", 4) })
+
+	var mu sync.Mutex
+	running, peak, done := 0, 0, 0
+	jobs := []func(){}
+	for i := 0; i < 6; i++ {
+		jobs = append(jobs, func() {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			done++
+			mu.Unlock()
+		})
+	}
+	if err := runWorkers(context.Background(), jobs); err != nil {
+		t.Fatal(err)
+	}
+	if done != 6 || peak != 2 {
+		t.Fatalf("expected 6 jobs on 2 workers, got %d on %d", done, peak)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done = 0
+	if err := runWorkers(ctx, jobs); err != context.Canceled || done != 0 {
+		t.Fatalf("expected cancelled jobs to be skipped, got %v after %d jobs", err, done)
+	}
+}
@@ -78,6 +78,12 @@ var doc = `{
                             }
                         }
                     },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
                     "422": {
                         "description": "Unprocessable Entity",
                         "schema": {
@@ -167,6 +173,12 @@ var doc = `{
                             "$ref": "#/definitions/api.ErrorMessage"
                         }
                     },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
                     "422": {
                         "description": "Unprocessable Entity",
                         "schema": {
@@ -197,6 +209,18 @@ var doc = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "block, cascade or reassign referencing operations",
+                        "name": "onDelete",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "broker slug receiving the operations when reassigning",
+                        "name": "reassignTo",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -215,6 +239,18 @@ var doc = `{
                             "$ref": "#/definitions/api.ErrorMessage"
                         }
                     },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -578,6 +614,72 @@ var doc = `{
                 }
             }
         },
+        "/history": {
+            "get": {
+                "description": "get changes made to all documents, newest first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List all changes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "filter by collection",
+                        "name": "collection",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "maximum number of events, defaults to 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/wallet.HistoryEvent"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/livez": {
+            "get": {
+                "description": "report whether the process is running, regardless of its dependencies",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Liveness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.Probe"
+                        }
+                    }
+                }
+            }
+        },
         "/operations": {
             "get": {
                 "description": "get all operations data",
@@ -645,6 +747,44 @@ var doc = `{
                 }
             }
         },
+        "/operations/{id}/history": {
+            "get": {
+                "description": "get all changes made to some operation, newest first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get operation history",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Operation id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/wallet.HistoryEvent"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    }
+                }
+            }
+        },
         "/portfolios": {
             "get": {
                 "description": "get all portfolio data",
@@ -658,7 +798,13 @@ var doc = `{
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "filter by year",
+                        "description": "value at the end of a day (2024-06-30), month (2024-06), quarter (2024-Q2) or year (2024), defaults to now",
+                        "name": "asOf",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "value at the end of a year",
                         "name": "year",
                         "in": "query"
                     }
@@ -673,6 +819,12 @@ var doc = `{
                             }
                         }
                     },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -697,6 +849,12 @@ var doc = `{
                             "type": "object"
                         }
                     },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
                     "422": {
                         "description": "Unprocessable Entity",
                         "schema": {
@@ -744,6 +902,12 @@ var doc = `{
                             "$ref": "#/definitions/api.ErrorMessage"
                         }
                     },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
                     "422": {
                         "description": "Unprocessable Entity",
                         "schema": {
@@ -774,6 +938,18 @@ var doc = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "block, cascade or reassign referencing operations",
+                        "name": "onDelete",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "portfolio slug receiving the operations when reassigning",
+                        "name": "reassignTo",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -789,6 +965,18 @@ var doc = `{
                             "$ref": "#/definitions/api.ErrorMessage"
                         }
                     },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -818,7 +1006,13 @@ var doc = `{
                     },
                     {
                         "type": "string",
-                        "description": "filter by year",
+                        "description": "value at the end of a day (2024-06-30), month (2024-06), quarter (2024-Q2) or year (2024), defaults to now",
+                        "name": "asOf",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "value at the end of a year",
                         "name": "year",
                         "in": "query"
                     }
@@ -836,6 +1030,108 @@ var doc = `{
                             "$ref": "#/definitions/api.ErrorMessage"
                         }
                     },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/prices/import": {
+            "post": {
+                "description": "import a price series, as CSV when the content type is text/csv or a JSON array otherwise, replacing stored prices of the same day",
+                "consumes": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Import prices",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ImportResult"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/prices/{itemType}/{symbol}": {
+            "get": {
+                "description": "get the stored prices of a symbol, oldest first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List prices",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Item type",
+                        "name": "itemType",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Symbol",
+                        "name": "symbol",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "first day, as YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "last day, as YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/wallet.Price"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -871,6 +1167,29 @@ var doc = `{
                 }
             }
         },
+        "/readyz": {
+            "get": {
+                "description": "report the status and latency of each dependency; fails while a critical one fails",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.Probe"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.Probe"
+                        }
+                    }
+                }
+            }
+        },
         "/sales": {
             "get": {
                 "description": "get all sales operations data",
@@ -1127,6 +1446,86 @@ var doc = `{
                 }
             }
         },
+        "/trash": {
+            "get": {
+                "description": "get all deleted brokers, portfolios and operations",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List the trash",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/trash/{collection}/{id}/restore": {
+            "post": {
+                "description": "restore some deleted broker, portfolio or operation",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Restore from the trash",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "brokers, portfolios or operations",
+                        "name": "collection",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Document id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorMessage"
+                        }
+                    }
+                }
+            }
+        },
         "/treasuries-direct/operations": {
             "post": {
                 "description": "insert new treasury direct operation",
@@ -1247,6 +1646,24 @@ var doc = `{
         }
     },
     "definitions": {
+        "api.Check": {
+            "type": "object",
+            "properties": {
+                "critical": {
+                    "description": "Critical checks make the service unready when failing.",
+                    "type": "boolean"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "latencyMs": {
+                    "type": "number"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
         "api.ErrorMessage": {
             "type": "object",
             "properties": {
@@ -1255,6 +1672,34 @@ var doc = `{
                 }
             }
         },
+        "api.ImportResult": {
+            "type": "object",
+            "properties": {
+                "imported": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.Probe": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/api.Check"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                },
+                "uptime": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
         "wallet.Broker": {
             "type": "object",
             "required": [
@@ -1265,6 +1710,12 @@ var doc = `{
                 "CNPJ": {
                     "type": "string"
                 },
+                "aliases": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "id": {
                     "type": "string"
                 },
@@ -1419,10 +1870,35 @@ var doc = `{
                 }
             }
         },
-        "wallet.OperationsList": {
-            "type": "array",
-            "items": {
-                "$ref": "#/definitions/wallet.Tradable"
+        "wallet.HistoryEvent": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "after": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "before": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "collection": {
+                    "type": "string"
+                },
+                "documentId": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "timestamp": {
+                    "type": "string"
+                }
             }
         },
         "wallet.Portfolio": {
@@ -1432,6 +1908,12 @@ var doc = `{
                 "slug"
             ],
             "properties": {
+                "aliases": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "costBasis": {
                     "type": "number"
                 },
@@ -1501,12 +1983,20 @@ var doc = `{
                     "type": "string"
                 },
                 "operations": {
-                    "type": "object",
-                    "$ref": "#/definitions/wallet.OperationsList"
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/wallet.Tradable"
+                    }
                 },
                 "overallReturn": {
                     "type": "number"
                 },
+                "quoteStale": {
+                    "type": "boolean"
+                },
+                "quotedAt": {
+                    "type": "string"
+                },
                 "sector": {
                     "type": "string"
                 },
@@ -1524,6 +2014,29 @@ var doc = `{
                 }
             }
         },
+        "wallet.Price": {
+            "type": "object",
+            "required": [
+                "date",
+                "itemType",
+                "price",
+                "symbol"
+            ],
+            "properties": {
+                "date": {
+                    "type": "string"
+                },
+                "itemType": {
+                    "type": "string"
+                },
+                "price": {
+                    "type": "number"
+                },
+                "symbol": {
+                    "type": "string"
+                }
+            }
+        },
         "wallet.Stock": {
             "type": "object",
             "required": [
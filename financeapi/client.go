@@ -4,25 +4,69 @@
 package financeapi
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/mfinancecombr/finance-wallet-api/tracing"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var financeClient = &http.Client{
-	Timeout: viper.GetDuration("financeapi.operation.timeout") * time.Second,
+type Client interface {
+	GetJSON(ctx context.Context, path string, target interface{}) error
 }
 
-func GetJSON(path string, target interface{}) error {
+type httpClient struct {
+	client *http.Client
+}
+
+// DefaultClient is used by GetJSON. Tests replace it with a Stub.
+var DefaultClient Client = &httpClient{client: &http.Client{}}
+
+// GetJSON requests path, giving up after the "financeapi.operation.timeout"
+// setting when set. It is read on each request, as the config file is
+// loaded after the client is created.
+func (h *httpClient) GetJSON(ctx context.Context, path string, target interface{}) error {
 	log.Debugf("[FinanceAPI] Retrieving %s", path)
 	url := viper.GetString("financeapi.url") + path
-	r, err := financeClient.Get(url)
+	if timeout := viper.GetDuration("financeapi.operation.timeout") * time.Second; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "financeapi.GET", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.url", url)))
+	defer span.End()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return err
 	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	r, err := h.client.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	span.SetAttributes(attribute.Int("http.status_code", r.StatusCode))
 	defer r.Body.Close()
+	// Rate limiting and server errors are failures to retry, not quotes.
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		err := fmt.Errorf("GET %s: unexpected status %s", path, r.Status)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
 	return json.NewDecoder(r.Body).Decode(target)
 }
+
+func GetJSON(ctx context.Context, path string, target interface{}) error {
+	return DefaultClient.GetJSON(ctx, path, target)
+}
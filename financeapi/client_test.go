@@ -0,0 +1,68 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira
+// Licensed under the BSD 3-Clause License
+
+package financeapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestGetJSONStatus(t *testing.T) {
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"lastPrice": 25}`))
+	}))
+	defer server.Close()
+	previous := viper.Get("financeapi.url")
+	viper.Set("financeapi.url", server.URL)
+	t.Cleanup(func() { viper.Set("financeapi.url", previous) })
+
+	client := &httpClient{client: server.Client()}
+	quote := map[string]interface{}{}
+	err := client.GetJSON(context.Background(), "/stocks/PETR4", &quote)
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("expected a status error, got %v", err)
+	}
+	if len(quote) != 0 {
+		t.Fatalf("expected the error body to be ignored, got %v", quote)
+	}
+
+	status = http.StatusOK
+	if err := client.GetJSON(context.Background(), "/stocks/PETR4", &quote); err != nil || quote["lastPrice"] != 25.0 {
+		t.Fatalf("unexpected quote %v (%v)", quote, err)
+	}
+}
+
+func TestGetJSONTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+	for key, value := range map[string]interface{}{
+		"financeapi.url":               server.URL,
+		"financeapi.operation.timeout": 1,
+	} {
+		key, previous := key, viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, previous) })
+	}
+
+	// The timeout set after the client was created applies.
+	start := time.Now()
+	err := DefaultClient.GetJSON(context.Background(), "/stocks/PETR4", &map[string]interface{}{})
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second {
+		t.Fatalf("expected a timeout after a second, got %v after %s", err, time.Since(start))
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira
+// Licensed under the BSD 3-Clause License
+
+package financeapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetHistory requests the daily prices of symbol over the last months,
+// returning each one as sent by the finance API. History is not cached, but
+// is skipped while requests are paused after repeated failures.
+func (q *QuoteClient) GetHistory(ctx context.Context, itemType, symbol string, months int) ([]json.RawMessage, error) {
+	if err := q.allow(); err != nil {
+		metrics.FinanceAPIRequests.WithLabelValues(itemType, "circuit_open").Inc()
+		return nil, err
+	}
+	path := fmt.Sprintf("/%s/historicals/%s?months=%d", itemType, symbol, months)
+	response := map[string][]json.RawMessage{}
+	start := time.Now()
+	err := q.client.GetJSON(ctx, path, &response)
+	metrics.FinanceAPIDuration.WithLabelValues(itemType).Observe(time.Since(start).Seconds())
+	if ctx.Err() != nil {
+		metrics.FinanceAPIRequests.WithLabelValues(itemType, "cancelled").Inc()
+		return nil, ctx.Err()
+	}
+	q.record(err)
+	if err != nil {
+		metrics.FinanceAPIRequests.WithLabelValues(itemType, "error").Inc()
+		log.Warnf("[FinanceAPI] Error on get %s: %v", path, err)
+		return nil, err
+	}
+	metrics.FinanceAPIRequests.WithLabelValues(itemType, "success").Inc()
+	return response["historicals"], nil
+}
+
+func GetHistory(ctx context.Context, itemType, symbol string, months int) ([]json.RawMessage, error) {
+	return defaultQuotes().GetHistory(ctx, itemType, symbol, months)
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira
+// Licensed under the BSD 3-Clause License
+
+package financeapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/metrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ErrCircuitOpen is returned while requests are skipped after repeated
+// failures.
+var ErrCircuitOpen = errors.New("finance API circuit open")
+
+// Quote is the finance API data of one symbol.
+type Quote struct {
+	Data      json.RawMessage
+	FetchedAt time.Time
+	// Stale is set when Data is the last known quote, served because the
+	// finance API could not be reached.
+	Stale bool
+}
+
+type QuoteOptions struct {
+	// TTL is how long a quote is served without asking the finance API.
+	TTL time.Duration
+	// Retries is how many times a failed request is repeated, waiting
+	// Backoff before the first retry and doubling it for each new one.
+	Retries int
+	Backoff time.Duration
+	// After BreakerFailures failed requests in a row, requests are skipped
+	// for Cooldown.
+	BreakerFailures int
+	Cooldown        time.Duration
+	// ProbePath is requested by Check, reusing the outcome for
+	// ProbeInterval. Check makes no request when empty.
+	ProbePath     string
+	ProbeInterval time.Duration
+}
+
+func quoteOptionsFromConfig() QuoteOptions {
+	return QuoteOptions{
+		TTL:             viper.GetDuration("financeapi.quotes.ttl") * time.Second,
+		Retries:         viper.GetInt("financeapi.retries"),
+		Backoff:         viper.GetDuration("financeapi.retry.backoff") * time.Millisecond,
+		BreakerFailures: viper.GetInt("financeapi.breaker.failures"),
+		Cooldown:        viper.GetDuration("financeapi.breaker.cooldown") * time.Second,
+		ProbePath:       viper.GetString("financeapi.probe.path"),
+		ProbeInterval:   viper.GetDuration("readyz.timeout") * time.Second,
+	}
+}
+
+// QuoteClient retrieves quotes through a Client, caching them and falling
+// back to the last known quotes when the finance API fails.
+type QuoteClient struct {
+	client Client
+	opts   QuoteOptions
+
+	mu        sync.Mutex
+	cache     map[string]Quote
+	failures  int
+	openUntil time.Time
+
+	// probeMu serializes probes, so concurrent checks share one request.
+	probeMu  sync.Mutex
+	probedAt time.Time
+	probeErr error
+}
+
+func NewQuoteClient(client Client, opts QuoteOptions) *QuoteClient {
+	return &QuoteClient{client: client, opts: opts, cache: map[string]Quote{}}
+}
+
+// DefaultQuotes is used by GetQuotes. It is created from the configuration
+// on first use when not set.
+var DefaultQuotes *QuoteClient
+
+var defaultQuotesMu sync.Mutex
+
+func defaultQuotes() *QuoteClient {
+	defaultQuotesMu.Lock()
+	defer defaultQuotesMu.Unlock()
+	if DefaultQuotes == nil {
+		DefaultQuotes = NewQuoteClient(DefaultClient, quoteOptionsFromConfig())
+	}
+	return DefaultQuotes
+}
+
+func GetQuotes(ctx context.Context, itemType string, symbols []string) (map[string]Quote, error) {
+	return defaultQuotes().GetQuotes(ctx, itemType, symbols)
+}
+
+// Check reports whether the finance API answers DefaultQuotes.
+func Check(ctx context.Context) error {
+	return defaultQuotes().Check(ctx)
+}
+
+func cacheKey(itemType, symbol string) string {
+	return itemType + "/" + symbol
+}
+
+// GetQuotes returns the quotes of symbols, keyed by symbol. Cached quotes
+// younger than the TTL are served without a request. When the request
+// fails the last known quotes are returned, marked as stale, along with
+// the error; symbols never quoted are missing from the result.
+func (q *QuoteClient) GetQuotes(ctx context.Context, itemType string, symbols []string) (map[string]Quote, error) {
+	quotes := map[string]Quote{}
+	missing := []string{}
+	q.mu.Lock()
+	now := time.Now()
+	for _, s := range symbols {
+		cached, ok := q.cache[cacheKey(itemType, s)]
+		if ok && now.Sub(cached.FetchedAt) < q.opts.TTL {
+			quotes[s] = cached
+		} else {
+			missing = append(missing, s)
+		}
+	}
+	q.mu.Unlock()
+	metrics.QuoteCache.WithLabelValues("hit").Add(float64(len(quotes)))
+	metrics.QuoteCache.WithLabelValues("miss").Add(float64(len(missing)))
+	if len(missing) == 0 {
+		return quotes, nil
+	}
+
+	fetched, err := q.fetch(ctx, itemType, missing)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for s, quote := range fetched {
+		q.cache[cacheKey(itemType, s)] = quote
+		quotes[s] = quote
+	}
+	if err != nil {
+		for _, s := range missing {
+			if cached, ok := q.cache[cacheKey(itemType, s)]; ok {
+				cached.Stale = true
+				quotes[s] = cached
+			}
+		}
+	}
+	return quotes, err
+}
+
+// Check requests ProbePath, returning the outcome of the last request when
+// younger than ProbeInterval, so frequent checks do not load the finance
+// API. While requests are paused after repeated failures it returns
+// ErrCircuitOpen without a request.
+func (q *QuoteClient) Check(ctx context.Context) error {
+	if err := q.allow(); err != nil {
+		return err
+	}
+	if q.opts.ProbePath == "" {
+		return nil
+	}
+	q.probeMu.Lock()
+	defer q.probeMu.Unlock()
+	if !q.probedAt.IsZero() && time.Since(q.probedAt) < q.opts.ProbeInterval {
+		return q.probeErr
+	}
+	response := map[string][]json.RawMessage{}
+	err := q.client.GetJSON(ctx, q.opts.ProbePath, &response)
+	// Probes abandoned by the caller say nothing of the finance API.
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	q.record(err)
+	q.probedAt, q.probeErr = time.Now(), err
+	return err
+}
+
+func (q *QuoteClient) allow() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if time.Now().Before(q.openUntil) {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+func (q *QuoteClient) record(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err == nil {
+		q.failures = 0
+		return
+	}
+	q.failures++
+	if q.opts.BreakerFailures > 0 && q.failures >= q.opts.BreakerFailures {
+		log.Warnf("[FinanceAPI] %d failures in a row, pausing requests for %s", q.failures, q.opts.Cooldown)
+		q.openUntil = time.Now().Add(q.opts.Cooldown)
+		q.failures = 0
+	}
+}
+
+// fetch requests the quotes of symbols, retrying with exponential backoff
+// until ctx is done.
+func (q *QuoteClient) fetch(ctx context.Context, itemType string, symbols []string) (map[string]Quote, error) {
+	path := fmt.Sprintf("/%s/?", itemType)
+	for _, s := range symbols {
+		path += fmt.Sprintf("symbols=%s&", s)
+	}
+	backoff := q.opts.Backoff
+	var err error
+	for attempt := 0; attempt <= q.opts.Retries; attempt++ {
+		if attempt > 0 {
+			log.Debugf("[FinanceAPI] Retrying %s in %s", path, backoff)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if err = q.allow(); err != nil {
+			metrics.FinanceAPIRequests.WithLabelValues(itemType, "circuit_open").Inc()
+			return nil, err
+		}
+		response := map[string][]json.RawMessage{}
+		start := time.Now()
+		err = q.client.GetJSON(ctx, path, &response)
+		metrics.FinanceAPIDuration.WithLabelValues(itemType).Observe(time.Since(start).Seconds())
+		// Requests abandoned by the caller say nothing of the finance API.
+		if ctx.Err() != nil {
+			metrics.FinanceAPIRequests.WithLabelValues(itemType, "cancelled").Inc()
+			return nil, ctx.Err()
+		}
+		q.record(err)
+		if err == nil {
+			metrics.FinanceAPIRequests.WithLabelValues(itemType, "success").Inc()
+			return parseQuotes(response)
+		}
+		metrics.FinanceAPIRequests.WithLabelValues(itemType, "error").Inc()
+		log.Warnf("[FinanceAPI] Error on get %s: %v", path, err)
+	}
+	return nil, err
+}
+
+func parseQuotes(response map[string][]json.RawMessage) (map[string]Quote, error) {
+	now := time.Now().UTC()
+	quotes := map[string]Quote{}
+	for _, items := range response {
+		for _, item := range items {
+			symbol := struct {
+				Symbol string `json:"symbol"`
+			}{}
+			if err := json.Unmarshal(item, &symbol); err != nil {
+				return nil, err
+			}
+			quotes[symbol.Symbol] = Quote{Data: item, FetchedAt: now}
+		}
+	}
+	return quotes, nil
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira
+// Licensed under the BSD 3-Clause License
+
+package financeapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestStub() *Stub {
+	return &Stub{
+		Quotes: map[string]map[string]map[string]interface{}{
+			"stocks": {"PETR4": {"lastPrice": 25}},
+		},
+	}
+}
+
+func TestQuoteCache(t *testing.T) {
+	stub := newTestStub()
+	client := NewQuoteClient(stub, QuoteOptions{TTL: time.Minute})
+	for i := 0; i < 3; i++ {
+		quotes, err := client.GetQuotes(context.Background(), "stocks", []string{"PETR4"})
+		if err != nil || string(quotes["PETR4"].Data) == "" {
+			t.Fatalf("unexpected quotes %v (%v)", quotes, err)
+		}
+	}
+	if stub.Requests != 1 {
+		t.Fatalf("expected 1 request, got %d", stub.Requests)
+	}
+}
+
+func TestQuoteRetriesAndBreaker(t *testing.T) {
+	stub := newTestStub()
+	client := NewQuoteClient(stub, QuoteOptions{
+		Retries:         2,
+		Backoff:         time.Millisecond,
+		BreakerFailures: 3,
+		Cooldown:        time.Hour,
+	})
+	if _, err := client.GetQuotes(context.Background(), "stocks", []string{"PETR4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stub.Err = errors.New("down")
+	quotes, err := client.GetQuotes(context.Background(), "stocks", []string{"PETR4"})
+	if err == nil || !quotes["PETR4"].Stale {
+		t.Fatalf("expected a stale quote and an error, got %v (%v)", quotes, err)
+	}
+	if stub.Requests != 4 {
+		t.Fatalf("expected 3 attempts, got %d", stub.Requests-1)
+	}
+
+	// The breaker is open: no request is made.
+	if _, err := client.GetQuotes(context.Background(), "stocks", []string{"PETR4"}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit open, got %v", err)
+	}
+	if stub.Requests != 4 {
+		t.Fatalf("expected no request while open, got %d", stub.Requests-4)
+	}
+}
+
+func TestQuoteCancelled(t *testing.T) {
+	stub := newTestStub()
+	stub.Err = errors.New("down")
+	client := NewQuoteClient(stub, QuoteOptions{Retries: 5, Backoff: time.Hour, BreakerFailures: 1, Cooldown: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.GetQuotes(ctx, "stocks", []string{"PETR4"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the request to be cancelled, got %v", err)
+	}
+	// Cancelled requests do not open the breaker.
+	stub.Err = nil
+	if _, err := client.GetQuotes(context.Background(), "stocks", []string{"PETR4"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQuoteCheck(t *testing.T) {
+	stub := newTestStub()
+	client := NewQuoteClient(stub, QuoteOptions{
+		BreakerFailures: 2,
+		Cooldown:        time.Hour,
+		ProbePath:       "/stocks/?symbols=PETR4",
+		ProbeInterval:   time.Hour,
+	})
+	for i := 0; i < 2; i++ {
+		if err := client.Check(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stub.Requests != 1 {
+		t.Fatalf("expected the probe to be reused, got %d requests", stub.Requests)
+	}
+
+	// Failed probes count towards opening the breaker.
+	stub.Err = errors.New("down")
+	client.opts.ProbeInterval = 0
+	if err := client.Check(context.Background()); err == nil {
+		t.Fatal("expected the probe to fail")
+	}
+	if err := client.Check(context.Background()); err == nil {
+		t.Fatal("expected the probe to fail")
+	}
+	if err := client.Check(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit open, got %v", err)
+	}
+	if stub.Requests != 3 {
+		t.Fatalf("expected no request while the circuit is open, got %d", stub.Requests)
+	}
+}
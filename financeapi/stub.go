@@ -0,0 +1,77 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira
+// Licensed under the BSD 3-Clause License
+
+package financeapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Stub answers requests for "/<itemType>/?symbols=..." with the quotes it
+// was given, and for "/<itemType>/historicals/<symbol>" with its
+// historicals, so the API can run without reaching the finance API.
+type Stub struct {
+	// Quotes maps item types to symbols to the quote fields returned for
+	// them, such as "lastPrice" or "name".
+	Quotes map[string]map[string]map[string]interface{}
+	// Historicals maps item types to symbols to their daily prices, with
+	// fields such as "date" and "close".
+	Historicals map[string]map[string][]map[string]interface{}
+	// Err, when set, is returned by every request.
+	Err error
+	// Requests counts the requests received.
+	Requests int
+
+	mu sync.Mutex
+}
+
+func (s *Stub) GetJSON(ctx context.Context, path string, target interface{}) error {
+	s.mu.Lock()
+	s.Requests++
+	err := s.Err
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	parsed, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	itemType := strings.Trim(parsed.Path, "/")
+	if parts := strings.Split(itemType, "/"); len(parts) == 3 && parts[1] == "historicals" {
+		return s.historicals(parts[0], parts[2], target)
+	}
+	quotes := []map[string]interface{}{}
+	for _, symbol := range parsed.Query()["symbols"] {
+		quote, ok := s.Quotes[itemType][symbol]
+		if !ok {
+			continue
+		}
+		item := map[string]interface{}{"symbol": symbol}
+		for k, v := range quote {
+			item[k] = v
+		}
+		quotes = append(quotes, item)
+	}
+	data, err := json.Marshal(map[string]interface{}{itemType: quotes})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func (s *Stub) historicals(itemType, symbol string, target interface{}) error {
+	historicals := s.Historicals[itemType][symbol]
+	if historicals == nil {
+		historicals = []map[string]interface{}{}
+	}
+	data, err := json.Marshal(map[string]interface{}{"historicals": historicals})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+// Package logging correlates the log entries of a request.
+package logging
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type requestKey struct{}
+
+type request struct {
+	id    string
+	actor string
+}
+
+// WithRequest returns a context whose log entries carry the request ID and
+// the actor making the request.
+func WithRequest(ctx context.Context, id, actor string) context.Context {
+	return context.WithValue(ctx, requestKey{}, request{id: id, actor: actor})
+}
+
+// Hook adds the request fields and trace ID stored in the context of an
+// entry, as set by log.WithContext, to the entry.
+type Hook struct{}
+
+func (Hook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (Hook) Fire(entry *log.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if r, ok := entry.Context.Value(requestKey{}).(request); ok {
+		entry.Data["request_id"] = r.id
+		entry.Data["actor"] = r.actor
+	}
+	if span := trace.SpanContextFromContext(entry.Context); span.IsValid() {
+		entry.Data["trace_id"] = span.TraceID().String()
+	}
+	return nil
+}
@@ -4,10 +4,13 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"os"
+
 	log "github.com/sirupsen/logrus"
 
-	"github.com/mfinancecombr/finance-wallet-api/api"
-	_ "github.com/mfinancecombr/finance-wallet-api/config"
+	"github.com/mfinancecombr/finance-wallet-api/cli"
 )
 
 // @title MFinance Wallet API
@@ -23,9 +26,10 @@ import (
 // @host localhost:8889
 // @BasePath /api/v1
 func main() {
-	server, err := api.NewServerFromDB()
-	if err != nil {
-		log.Error(err)
+	if err := cli.Run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatal(err)
 	}
-	server.Start()
 }
@@ -0,0 +1,108 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package marketdata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Chain asks its providers in order, falling back to the next one for the
+// data a provider fails to return.
+type Chain struct {
+	providers []Provider
+}
+
+func NewChain(providers ...Provider) *Chain {
+	return &Chain{providers: providers}
+}
+
+func (c *Chain) Name() string {
+	names := []string{}
+	for _, p := range c.providers {
+		names = append(names, p.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Quotes asks each provider for the symbols still missing. A stale quote is
+// replaced by a fresh one from a later provider when there is one.
+func (c *Chain) Quotes(ctx context.Context, itemType string, symbols []string) (map[string]Quote, error) {
+	quotes := map[string]Quote{}
+	missing := symbols
+	var lastErr error
+	for _, p := range c.providers {
+		if len(missing) == 0 {
+			break
+		}
+		result, err := p.Quotes(ctx, itemType, missing)
+		if err != nil {
+			log.Warnf("[MarketData] %s quotes: %v", p.Name(), err)
+			lastErr = err
+		}
+		remaining := []string{}
+		for _, symbol := range missing {
+			quote, ok := result[symbol]
+			if ok {
+				quotes[symbol] = quote
+			}
+			if !ok || quote.Stale {
+				remaining = append(remaining, symbol)
+			}
+		}
+		missing = remaining
+	}
+	if len(missing) == 0 {
+		return quotes, nil
+	}
+	return quotes, lastErr
+}
+
+func (c *Chain) History(ctx context.Context, itemType, symbol string, from, to time.Time) ([]Price, error) {
+	err := ErrNotSupported
+	for _, p := range c.providers {
+		prices, e := p.History(ctx, itemType, symbol, from, to)
+		if e == nil {
+			return prices, nil
+		}
+		if !errors.Is(e, ErrNotSupported) && !errors.Is(e, ErrNotFound) {
+			log.Warnf("[MarketData] %s history: %v", p.Name(), e)
+		}
+		err = e
+	}
+	return nil, err
+}
+
+func (c *Chain) Asset(ctx context.Context, itemType, symbol string) (*Asset, error) {
+	err := ErrNotSupported
+	for _, p := range c.providers {
+		asset, e := p.Asset(ctx, itemType, symbol)
+		if e == nil {
+			return asset, nil
+		}
+		if !errors.Is(e, ErrNotSupported) && !errors.Is(e, ErrNotFound) {
+			log.Warnf("[MarketData] %s asset: %v", p.Name(), e)
+		}
+		err = e
+	}
+	return nil, err
+}
+
+// Check succeeds when any provider can serve data.
+func (c *Chain) Check(ctx context.Context) error {
+	errs := []string{}
+	for _, p := range c.providers {
+		err := p.Check(ctx)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", p.Name(), err))
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
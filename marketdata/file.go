@@ -0,0 +1,259 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package marketdata
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	log "github.com/sirupsen/logrus"
+)
+
+const dateLayout = "2006-01-02"
+
+// Record is a row of a price file.
+type Record struct {
+	Date      string         `json:"date"`
+	ItemType  string         `json:"itemType"`
+	Name      string         `json:"name"`
+	Price     wallet.Decimal `json:"price"`
+	Sector    string         `json:"sector"`
+	Segment   string         `json:"segment"`
+	SubSector string         `json:"subSector"`
+	Symbol    string         `json:"symbol"`
+}
+
+type fileSymbol struct {
+	asset  Asset
+	prices []Price
+}
+
+// File provides prices from a local CSV or JSON file, chosen by its
+// extension. CSV files have a header naming the columns; JSON files are an
+// array of objects. Both use the fields itemType, symbol, date (YYYY-MM-DD)
+// and price, and optionally name, sector, subSector and segment. The file
+// is read again whenever it changes.
+type File struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	symbols map[string]*fileSymbol
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (p *File) Name() string {
+	return "file"
+}
+
+// Price file formats.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// ReadRecords parses the rows of a price file in the given format.
+func ReadRecords(r io.Reader, format string) ([]Record, error) {
+	switch format {
+	case FormatCSV:
+		return readCSV(r)
+	case FormatJSON:
+		records := []Record{}
+		if err := json.NewDecoder(r).Decode(&records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+	return nil, fmt.Errorf("unknown price file format '%s'", format)
+}
+
+// ParseDate parses the date of a record.
+func (r Record) ParseDate() (time.Time, error) {
+	return time.Parse(dateLayout, r.Date)
+}
+
+func readCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, required := range []string{"itemType", "symbol", "date", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing column '%s'", required)
+		}
+	}
+	get := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	records := []Record{}
+	for n, row := range rows[1:] {
+		price, err := wallet.NewDecimalFromString(get(row, "price"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid price: %v", n+2, err)
+		}
+		records = append(records, Record{
+			Date:      get(row, "date"),
+			ItemType:  get(row, "itemType"),
+			Name:      get(row, "name"),
+			Price:     price,
+			Sector:    get(row, "sector"),
+			Segment:   get(row, "segment"),
+			SubSector: get(row, "subSector"),
+			Symbol:    get(row, "symbol"),
+		})
+	}
+	return records, nil
+}
+
+func fileKey(itemType, symbol string) string {
+	return itemType + "/" + symbol
+}
+
+// load reads the file when it changed since the last read.
+func (p *File) load() (map[string]*fileSymbol, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, err
+	}
+	if p.symbols != nil && info.ModTime().Equal(p.modTime) {
+		return p.symbols, nil
+	}
+
+	log.Debugf("[MarketData] Reading %s", p.path)
+	f, err := os.Open(p.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	format := FormatCSV
+	if strings.EqualFold(filepath.Ext(p.path), ".json") {
+		format = FormatJSON
+	}
+	records, err := ReadRecords(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", p.path, err)
+	}
+
+	symbols := map[string]*fileSymbol{}
+	for _, r := range records {
+		date, err := r.ParseDate()
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid date of %s: %v", p.path, r.Symbol, err)
+		}
+		key := fileKey(r.ItemType, r.Symbol)
+		s, ok := symbols[key]
+		if !ok {
+			s = &fileSymbol{asset: Asset{ItemType: r.ItemType, Symbol: r.Symbol}}
+			symbols[key] = s
+		}
+		for field, value := range map[*string]string{
+			&s.asset.Name:      r.Name,
+			&s.asset.Sector:    r.Sector,
+			&s.asset.Segment:   r.Segment,
+			&s.asset.SubSector: r.SubSector,
+		} {
+			if value != "" {
+				*field = value
+			}
+		}
+		s.prices = append(s.prices, Price{Date: date, Price: r.Price})
+	}
+	for _, s := range symbols {
+		sort.SliceStable(s.prices, func(i, j int) bool {
+			return s.prices[i].Date.Before(s.prices[j].Date)
+		})
+	}
+	p.symbols = symbols
+	p.modTime = info.ModTime()
+	return symbols, nil
+}
+
+// Check fails when the file cannot be read.
+func (p *File) Check(ctx context.Context) error {
+	_, err := p.load()
+	return err
+}
+
+func (p *File) Quotes(ctx context.Context, itemType string, symbols []string) (map[string]Quote, error) {
+	data, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	quotes := map[string]Quote{}
+	for _, symbol := range symbols {
+		s, ok := data[fileKey(itemType, symbol)]
+		if !ok || len(s.prices) == 0 {
+			continue
+		}
+		last := s.prices[len(s.prices)-1]
+		quotes[symbol] = Quote{
+			LastPrice: last.Price,
+			Name:      s.asset.Name,
+			Sector:    s.asset.Sector,
+			Segment:   s.asset.Segment,
+			SubSector: s.asset.SubSector,
+			Symbol:    symbol,
+			Time:      last.Date,
+		}
+	}
+	return quotes, nil
+}
+
+func (p *File) History(ctx context.Context, itemType, symbol string, from, to time.Time) ([]Price, error) {
+	data, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	s, ok := data[fileKey(itemType, symbol)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	prices := []Price{}
+	for _, price := range s.prices {
+		if !price.Date.Before(from) && !price.Date.After(to) {
+			prices = append(prices, price)
+		}
+	}
+	return prices, nil
+}
+
+func (p *File) Asset(ctx context.Context, itemType, symbol string) (*Asset, error) {
+	data, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	s, ok := data[fileKey(itemType, symbol)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	asset := s.asset
+	return &asset, nil
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package marketdata
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/financeapi"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFileProvider(t *testing.T) {
+	csvPath := writeFile(t, "prices.csv", `itemType,symbol,date,price,name
+stocks,PETR4,2020-01-03,30.10,
+stocks,PETR4,2020-01-02,29.90,Petrobras
+fiis,HGLG11,2020-01-02,170,
+`)
+	jsonPath := writeFile(t, "prices.json", `[
+  {"itemType": "stocks", "symbol": "PETR4", "date": "2020-01-02", "price": 29.90, "name": "Petrobras"},
+  {"itemType": "stocks", "symbol": "PETR4", "date": "2020-01-03", "price": "30.10"},
+  {"itemType": "fiis", "symbol": "HGLG11", "date": "2020-01-02", "price": 170}
+]`)
+
+	for _, path := range []string{csvPath, jsonPath} {
+		p := NewFile(path)
+		quotes, err := p.Quotes(context.Background(), "stocks", []string{"PETR4", "VALE3"})
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		quote := quotes["PETR4"]
+		if len(quotes) != 1 || quote.LastPrice.String() != "30.1" || quote.Name != "Petrobras" {
+			t.Fatalf("%s: unexpected quotes %+v", path, quotes)
+		}
+		if !quote.Time.Equal(time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)) {
+			t.Fatalf("%s: unexpected quote time %s", path, quote.Time)
+		}
+
+		from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+		prices, err := p.History(context.Background(), "stocks", "PETR4", from, to)
+		if err != nil || len(prices) != 1 || prices[0].Price.String() != "29.9" {
+			t.Fatalf("%s: unexpected history %+v (%v)", path, prices, err)
+		}
+
+		if _, err := p.Asset(context.Background(), "stocks", "VALE3"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: expected not found, got %v", path, err)
+		}
+	}
+}
+
+type failingProvider struct{}
+
+func (failingProvider) Name() string { return "failing" }
+
+func (failingProvider) Quotes(ctx context.Context, itemType string, symbols []string) (map[string]Quote, error) {
+	return nil, errors.New("down")
+}
+
+func (failingProvider) History(ctx context.Context, itemType, symbol string, from, to time.Time) ([]Price, error) {
+	return nil, ErrNotSupported
+}
+
+func (failingProvider) Check(ctx context.Context) error {
+	return errors.New("down")
+}
+
+func (failingProvider) Asset(ctx context.Context, itemType, symbol string) (*Asset, error) {
+	return nil, ErrNotSupported
+}
+
+func TestChain(t *testing.T) {
+	path := writeFile(t, "prices.csv", "itemType,symbol,date,price\nstocks,PETR4,2020-01-02,29.90\n")
+	chain := NewChain(failingProvider{}, NewFile(path))
+
+	quotes, err := chain.Quotes(context.Background(), "stocks", []string{"PETR4"})
+	if err != nil || quotes["PETR4"].LastPrice.String() != "29.9" {
+		t.Fatalf("expected the file quote, got %+v (%v)", quotes, err)
+	}
+
+	quotes, err = chain.Quotes(context.Background(), "stocks", []string{"VALE3"})
+	if err == nil || len(quotes) != 0 {
+		t.Fatalf("expected an error for unknown symbols, got %+v (%v)", quotes, err)
+	}
+
+	asset, err := chain.Asset(context.Background(), "stocks", "PETR4")
+	if err != nil || asset.Symbol != "PETR4" {
+		t.Fatalf("unexpected asset %+v (%v)", asset, err)
+	}
+
+	if err := chain.Check(context.Background()); err != nil {
+		t.Fatalf("expected the file to serve data, got %v", err)
+	}
+	if err := NewChain(failingProvider{}, NewFile(path+".missing")).Check(context.Background()); err == nil {
+		t.Fatal("expected the check to fail without any working provider")
+	}
+}
+
+func TestMFinanceHistory(t *testing.T) {
+	stub := &financeapi.Stub{
+		Historicals: map[string]map[string][]map[string]interface{}{
+			"stocks": {"PETR4": {
+				{"date": "2020-01-03T00:00:00Z", "close": 30.10},
+				{"date": "2020-01-02T00:00:00Z", "close": 29.90},
+				{"date": "2019-12-30T00:00:00Z", "close": 29.00},
+			}},
+		},
+	}
+	previous := financeapi.DefaultQuotes
+	financeapi.DefaultQuotes = financeapi.NewQuoteClient(stub, financeapi.QuoteOptions{})
+	t.Cleanup(func() { financeapi.DefaultQuotes = previous })
+
+	p := &MFinance{}
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+	prices, err := p.History(context.Background(), "stocks", "PETR4", from, to)
+	if err != nil || len(prices) != 2 || prices[0].Price.String() != "29.9" || !prices[1].Date.Equal(from.AddDate(0, 0, 2)) {
+		t.Fatalf("unexpected history %+v (%v)", prices, err)
+	}
+
+	if _, err := p.History(context.Background(), "stocks", "VALE3", from, to); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if _, err := p.History(context.Background(), "ficfi", "FUND", from, to); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected not supported, got %v", err)
+	}
+}
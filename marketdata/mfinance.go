@@ -0,0 +1,101 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package marketdata
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/financeapi"
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+)
+
+// MFinance provides the quotes of the mfinance API, through the cache of
+// financeapi.
+type MFinance struct{}
+
+func (p *MFinance) Name() string {
+	return "mfinance"
+}
+
+func (p *MFinance) Quotes(ctx context.Context, itemType string, symbols []string) (map[string]Quote, error) {
+	raw, err := financeapi.GetQuotes(ctx, itemType, symbols)
+	quotes := map[string]Quote{}
+	for symbol, r := range raw {
+		quote := Quote{}
+		if decodeErr := json.Unmarshal(r.Data, &quote); decodeErr != nil {
+			return nil, decodeErr
+		}
+		quote.Symbol = symbol
+		quote.Time = r.FetchedAt
+		quote.Stale = r.Stale
+		quotes[symbol] = quote
+	}
+	return quotes, err
+}
+
+// Check makes a request to the finance API, at most once per readiness
+// timeout, and fails while requests are paused after repeated failures.
+func (p *MFinance) Check(ctx context.Context) error {
+	return financeapi.Check(ctx)
+}
+
+// History returns the closing prices of stocks and FIIs, the item types
+// with historicals in the mfinance API.
+func (p *MFinance) History(ctx context.Context, itemType, symbol string, from, to time.Time) ([]Price, error) {
+	if itemType != wallet.StockItemType && itemType != wallet.FIIItemType {
+		return nil, ErrNotSupported
+	}
+	// Historicals are requested by months back from today.
+	now := time.Now().UTC()
+	months := (now.Year()-from.Year())*12 + int(now.Month()-from.Month()) + 1
+	if months < 1 {
+		months = 1
+	}
+	raw, err := financeapi.GetHistory(ctx, itemType, symbol, months)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, ErrNotFound
+	}
+	prices := []Price{}
+	for _, r := range raw {
+		historical := struct {
+			Close wallet.Decimal `json:"close"`
+			Date  time.Time      `json:"date"`
+		}{}
+		if err := json.Unmarshal(r, &historical); err != nil {
+			return nil, err
+		}
+		y, m, d := historical.Date.UTC().Date()
+		date := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		if !date.Before(from) && !date.After(to) {
+			prices = append(prices, Price{Date: date, Price: historical.Close})
+		}
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Date.Before(prices[j].Date) })
+	return prices, nil
+}
+
+func (p *MFinance) Asset(ctx context.Context, itemType, symbol string) (*Asset, error) {
+	quotes, err := p.Quotes(ctx, itemType, []string{symbol})
+	if err != nil {
+		return nil, err
+	}
+	quote, ok := quotes[symbol]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &Asset{
+		ItemType:  itemType,
+		Name:      quote.Name,
+		Sector:    quote.Sector,
+		Segment:   quote.Segment,
+		SubSector: quote.SubSector,
+		Symbol:    symbol,
+	}, nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package marketdata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mfinancecombr/finance-wallet-api/wallet"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+var (
+	// ErrNotSupported is returned by providers lacking some kind of data.
+	ErrNotSupported = errors.New("not supported by provider")
+	ErrNotFound     = errors.New("not found")
+)
+
+type Quote struct {
+	Change       wallet.Decimal `json:"change"`
+	ClosingPrice wallet.Decimal `json:"closingPrice"`
+	LastPrice    wallet.Decimal `json:"lastPrice"`
+	LastYearHigh wallet.Decimal `json:"lastYearHigh"`
+	LastYearLow  wallet.Decimal `json:"lastYearLow"`
+	Name         string         `json:"name"`
+	Sector       string         `json:"sector"`
+	Segment      string         `json:"segment"`
+	SubSector    string         `json:"subSector"`
+	Symbol       string         `json:"symbol"`
+	// Time is when the quote was retrieved or, for price files, the date of
+	// the price.
+	Time time.Time `json:"-"`
+	// Stale is set for last known quotes, served because the source could
+	// not be reached.
+	Stale bool `json:"-"`
+}
+
+// Price is the closing price of a symbol on a day.
+type Price struct {
+	Date  time.Time
+	Price wallet.Decimal
+}
+
+type Asset struct {
+	ItemType  string
+	Name      string
+	Sector    string
+	Segment   string
+	SubSector string
+	Symbol    string
+}
+
+// Provider is a source of market data. Methods return ErrNotSupported for
+// data the source does not have.
+type Provider interface {
+	Name() string
+	// Quotes returns the quotes of symbols keyed by symbol, without the
+	// symbols the provider does not know.
+	Quotes(ctx context.Context, itemType string, symbols []string) (map[string]Quote, error)
+	// History returns the prices of symbol between from and to, inclusive,
+	// sorted by date.
+	History(ctx context.Context, itemType, symbol string, from, to time.Time) ([]Price, error)
+	Asset(ctx context.Context, itemType, symbol string) (*Asset, error)
+	// Check reports whether the provider can currently serve data.
+	Check(ctx context.Context) error
+}
+
+// New returns the providers listed by the comma separated
+// "marketdata.providers" setting, chained in that order.
+func New() (Provider, error) {
+	providers := []Provider{}
+	for _, name := range strings.Split(viper.GetString("marketdata.providers"), ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+			continue
+		case "mfinance":
+			providers = append(providers, &MFinance{})
+		case "file":
+			providers = append(providers, NewFile(viper.GetString("marketdata.file.path")))
+		default:
+			return nil, fmt.Errorf("unknown market data provider '%s'", name)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, errors.New("no market data provider configured")
+	}
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+	return NewChain(providers...), nil
+}
+
+// Default is used by the package level functions. It is created by New on
+// first use when not set.
+var Default Provider
+
+var defaultMu sync.Mutex
+
+func defaultProvider() Provider {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if Default == nil {
+		provider, err := New()
+		if err != nil {
+			log.Errorf("[MarketData] %s, using mfinance", err)
+			provider = &MFinance{}
+		}
+		Default = provider
+	}
+	return Default
+}
+
+func GetQuotes(ctx context.Context, itemType string, symbols []string) (map[string]Quote, error) {
+	return defaultProvider().Quotes(ctx, itemType, symbols)
+}
+
+func GetHistory(ctx context.Context, itemType, symbol string, from, to time.Time) ([]Price, error) {
+	return defaultProvider().History(ctx, itemType, symbol, from, to)
+}
+
+func GetAsset(ctx context.Context, itemType, symbol string) (*Asset, error) {
+	return defaultProvider().Asset(ctx, itemType, symbol)
+}
+
+// Check reports whether the default provider can currently serve data.
+func Check(ctx context.Context) error {
+	return defaultProvider().Check(ctx)
+}
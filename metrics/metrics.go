@@ -0,0 +1,85 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+// Package metrics holds the Prometheus metrics of the service.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "finance_wallet"
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latencies by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	DBDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_operation_duration_seconds",
+		Help:      "Database operation latencies by backend, operation and collection.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "operation", "collection"})
+
+	DBErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_operation_errors_total",
+		Help:      "Failed database operations by backend, operation and collection.",
+	}, []string{"backend", "operation", "collection"})
+
+	FinanceAPIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "financeapi_requests_total",
+		Help:      "Finance API requests by item type and outcome: success, error, circuit_open or cancelled.",
+	}, []string{"item_type", "outcome"})
+
+	FinanceAPIDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "financeapi_request_duration_seconds",
+		Help:      "Finance API request latencies by item type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"item_type"})
+
+	QuoteCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quote_cache_lookups_total",
+		Help:      "Quote cache lookups by result: hit or miss.",
+	}, []string{"result"})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests refused for exceeding the rate limit, by route group.",
+	}, []string{"group"})
+)
+
+// NewRegistry returns a registry with the Go runtime, process and service
+// metrics, along with extra collectors.
+func NewRegistry(extra ...prometheus.Collector) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		DBDuration,
+		DBErrors,
+		FinanceAPIRequests,
+		FinanceAPIDuration,
+		QuoteCache,
+		RateLimited,
+	)
+	registry.MustRegister(extra...)
+	return registry
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+// Package tracing sets up OpenTelemetry tracing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "finance-wallet-api"
+
+// Tracer returns the tracer of the service.
+func Tracer() trace.Tracer {
+	return otel.Tracer(serviceName)
+}
+
+// Setup installs the exporter chosen by the "tracing.exporter" setting:
+// "otlp" sends spans over OTLP/HTTP to "tracing.otlp.endpoint", while
+// "none" keeps the no-op default. W3C trace context is propagated either
+// way. The returned function flushes the pending spans.
+func Setup(version string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	noop := func(context.Context) error { return nil }
+
+	exporter := viper.GetString("tracing.exporter")
+	switch exporter {
+	case "", "none":
+		return noop, nil
+	case "otlp":
+	default:
+		return noop, fmt.Errorf("unknown tracing exporter '%s'", exporter)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(viper.GetString("tracing.otlp.endpoint")),
+	}
+	if viper.GetBool("tracing.otlp.insecure") {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	client, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return noop, err
+	}
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(version),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(client),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(
+			sdktrace.TraceIDRatioBased(viper.GetFloat64("tracing.sample.ratio")),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	log.Infof("[Tracing] Exporting spans to %s", viper.GetString("tracing.otlp.endpoint"))
+	return provider.Shutdown, nil
+}
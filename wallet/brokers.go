@@ -4,10 +4,11 @@
 package wallet
 
 type Broker struct {
-	CNPJ string `json:"CNPJ" bson:"CNPJ"`
-	ID   string `json:"id,omitempty" bson:"_id,omitempty"`
-	Name string `json:"name" bson:"name" validate:"required"`
-	Slug string `json:"slug" bson:"slug" validate:"required"`
+	Aliases []string `json:"aliases,omitempty" bson:"aliases,omitempty"`
+	CNPJ    string   `json:"CNPJ" bson:"CNPJ"`
+	ID      string   `json:"id,omitempty" bson:"_id,omitempty"`
+	Name    string   `json:"name" bson:"name" validate:"required"`
+	Slug    string   `json:"slug" bson:"slug" validate:"required"`
 }
 
 type BrokersList struct {
@@ -21,3 +22,11 @@ func (s Broker) GetCollectionName() string {
 func (s Broker) GetItemType() string {
 	return ""
 }
+
+func (s Broker) GetID() string {
+	return s.ID
+}
+
+func (s Broker) GetSlug() string {
+	return s.Slug
+}
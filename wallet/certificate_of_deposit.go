@@ -9,36 +9,36 @@ import (
 
 type CertificateOfDeposit struct {
 	BrokerSlug        string     `json:"brokerSlug" bson:"brokerSlug" validate:"required"`
-	Commission        float64    `json:"commission" bson:"commission"`
+	Commission        Decimal    `json:"commission" bson:"commission"`
 	Date              *time.Time `json:"date" bson:"date" validate:"required"`
 	DueDate           *time.Time `json:"dueDate" bson:"dueDate" validate:"required"`
 	FixedInterestRate float64    `json:"fixedInterestRate" bson:"fixedInterestRate" validate:"required"`
 	ID                string     `json:"id,omitempty" bson:"_id,omitempty"`
 	ItemType          string     `json:"itemType" bson:"itemType" validate:"required"`
 	PortfolioSlug     string     `json:"portfolioSlug" bson:"portfolioSlug" validate:"required"`
-	Price             float64    `json:"price" bson:"price" validate:"required"`
-	Shares            float64    `json:"shares" bson:"shares" validate:"required"`
+	Price             Decimal    `json:"price" bson:"price" validate:"required"`
+	Shares            Decimal    `json:"shares" bson:"shares" validate:"required"`
 	Symbol            string     `json:"symbol" bson:"symbol" validate:"required"`
 	Type              string     `json:"type" bson:"type" validate:"required"`
 }
 
 type CertificateOfDepositList []CertificateOfDeposit
 
-const CertificateOfDepositItemType = "certificate-of-deposit"
+const CertificateOfDepositItemType = "certificates-of-deposit"
 
 func NewCertificateOfDeposit() *CertificateOfDeposit {
 	return &CertificateOfDeposit{ItemType: CertificateOfDepositItemType}
 }
 
-func (s CertificateOfDeposit) GetPrice() float64 {
+func (s CertificateOfDeposit) GetPrice() Decimal {
 	return s.Price
 }
 
-func (s CertificateOfDeposit) GetShares() float64 {
+func (s CertificateOfDeposit) GetShares() Decimal {
 	return s.Shares
 }
 
-func (s CertificateOfDeposit) GetComission() float64 {
+func (s CertificateOfDeposit) GetComission() Decimal {
 	return s.Commission
 }
 
@@ -50,6 +50,17 @@ func (s CertificateOfDeposit) GetBrokerSlug() string {
 	return s.BrokerSlug
 }
 
+func (s CertificateOfDeposit) GetPortfolioSlug() string {
+	return s.PortfolioSlug
+}
+
+// SetReferences replaces the broker and portfolio slugs, such as an alias by
+// the current slug.
+func (s *CertificateOfDeposit) SetReferences(brokerSlug, portfolioSlug string) {
+	s.BrokerSlug = brokerSlug
+	s.PortfolioSlug = portfolioSlug
+}
+
 func (s CertificateOfDeposit) GetCollectionName() string {
 	return "operations"
 }
@@ -57,3 +68,7 @@ func (s CertificateOfDeposit) GetCollectionName() string {
 func (s CertificateOfDeposit) GetItemType() string {
 	return CertificateOfDepositItemType
 }
+
+func (s CertificateOfDeposit) GetID() string {
+	return s.ID
+}
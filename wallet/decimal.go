@@ -0,0 +1,131 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package wallet
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Decimal is an exact fixed-point number, serialized as a JSON number and
+// stored as Decimal128 in MongoDB.
+type Decimal struct {
+	value decimal.Decimal
+}
+
+// Money is a Decimal presented with two decimal places, rounded half-up.
+// Calculations keep the exact value; rounding only happens on JSON output.
+type Money struct {
+	Decimal
+}
+
+var Zero = Decimal{}
+
+func NewDecimalFromFloat(f float64) Decimal {
+	return Decimal{value: decimal.NewFromFloat(f)}
+}
+
+func NewDecimalFromInt(i int64) Decimal {
+	return Decimal{value: decimal.NewFromInt(i)}
+}
+
+func NewDecimalFromString(s string) (Decimal, error) {
+	d, err := decimal.NewFromString(s)
+	return Decimal{value: d}, err
+}
+
+func NewMoney(d Decimal) Money {
+	return Money{Decimal: d}
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	return Decimal{value: d.value.Add(o.value)}
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	return Decimal{value: d.value.Sub(o.value)}
+}
+
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{value: d.value.Mul(o.value)}
+}
+
+// Div panics when o is zero, like integer division.
+func (d Decimal) Div(o Decimal) Decimal {
+	return Decimal{value: d.value.Div(o.value)}
+}
+
+func (d Decimal) Round(places int32) Decimal {
+	return Decimal{value: d.value.Round(places)}
+}
+
+func (d Decimal) Cmp(o Decimal) int {
+	return d.value.Cmp(o.value)
+}
+
+func (d Decimal) Sign() int {
+	return d.value.Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.value.IsZero()
+}
+
+func (d Decimal) Float64() float64 {
+	f, _ := d.value.Float64()
+	return f
+}
+
+func (d Decimal) String() string {
+	return d.value.String()
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.value.String()), nil
+}
+
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	return d.value.UnmarshalJSON(b)
+}
+
+func (d Decimal) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	d128, err := primitive.ParseDecimal128(d.value.String())
+	if err != nil {
+		return 0, nil, err
+	}
+	return bsontype.Decimal128, bsoncore.AppendDecimal128(nil, d128), nil
+}
+
+// UnmarshalBSONValue also accepts numbers stored as doubles and integers by
+// older versions.
+func (d *Decimal) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	v := bsoncore.Value{Type: t, Data: data}
+	switch t {
+	case bsontype.Decimal128:
+		parsed, err := decimal.NewFromString(v.Decimal128().String())
+		if err != nil {
+			return err
+		}
+		d.value = parsed
+	case bsontype.Double:
+		d.value = decimal.NewFromFloat(v.Double())
+	case bsontype.Int32:
+		d.value = decimal.NewFromInt32(v.Int32())
+	case bsontype.Int64:
+		d.value = decimal.NewFromInt(v.Int64())
+	case bsontype.Null, bsontype.Undefined:
+		d.value = decimal.Decimal{}
+	default:
+		return fmt.Errorf("cannot decode %s into a decimal", t)
+	}
+	return nil
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.value.Round(2).StringFixed(2)), nil
+}
@@ -9,13 +9,13 @@ import (
 
 type FII struct {
 	BrokerSlug    string     `json:"brokerSlug" bson:"brokerSlug" validate:"required"`
-	Commission    float64    `json:"commission" bson:"commission"`
+	Commission    Decimal    `json:"commission" bson:"commission"`
 	Date          *time.Time `json:"date" bson:"date" validate:"required"`
 	ID            string     `json:"id,omitempty" bson:"_id,omitempty"`
 	ItemType      string     `json:"itemType" bson:"itemType" validate:"required"`
 	PortfolioSlug string     `json:"portfolioSlug" bson:"portfolioSlug" validate:"required"`
-	Price         float64    `json:"price" bson:"price" validate:"required"`
-	Shares        float64    `json:"shares" bson:"shares" validate:"required"`
+	Price         Decimal    `json:"price" bson:"price" validate:"required"`
+	Shares        Decimal    `json:"shares" bson:"shares" validate:"required"`
 	Symbol        string     `json:"symbol" bson:"symbol" validate:"required"`
 	Type          string     `json:"type" bson:"type" validate:"required"`
 }
@@ -28,15 +28,15 @@ func NewFII() *FII {
 	return &FII{ItemType: FIIItemType}
 }
 
-func (s FII) GetPrice() float64 {
+func (s FII) GetPrice() Decimal {
 	return s.Price
 }
 
-func (s FII) GetShares() float64 {
+func (s FII) GetShares() Decimal {
 	return s.Shares
 }
 
-func (s FII) GetComission() float64 {
+func (s FII) GetComission() Decimal {
 	return s.Commission
 }
 
@@ -48,6 +48,17 @@ func (s FII) GetBrokerSlug() string {
 	return s.BrokerSlug
 }
 
+func (s FII) GetPortfolioSlug() string {
+	return s.PortfolioSlug
+}
+
+// SetReferences replaces the broker and portfolio slugs, such as an alias by
+// the current slug.
+func (s *FII) SetReferences(brokerSlug, portfolioSlug string) {
+	s.BrokerSlug = brokerSlug
+	s.PortfolioSlug = portfolioSlug
+}
+
 func (s FII) GetCollectionName() string {
 	return "operations"
 }
@@ -55,3 +66,7 @@ func (s FII) GetCollectionName() string {
 func (s FII) GetItemType() string {
 	return FIIItemType
 }
+
+func (s FII) GetID() string {
+	return s.ID
+}
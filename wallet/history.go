@@ -0,0 +1,42 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira
+// Licensed under the BSD 3-Clause License
+
+package wallet
+
+import (
+	"time"
+)
+
+const (
+	HistoryCreate  = "create"
+	HistoryUpdate  = "update"
+	HistoryDelete  = "delete"
+	HistoryRestore = "restore"
+	HistoryPurge   = "purge"
+)
+
+type HistoryEvent struct {
+	Action     string                 `json:"action" bson:"action"`
+	Actor      string                 `json:"actor" bson:"actor"`
+	After      map[string]interface{} `json:"after,omitempty" bson:"after,omitempty"`
+	Before     map[string]interface{} `json:"before,omitempty" bson:"before,omitempty"`
+	Collection string                 `json:"collection" bson:"collection"`
+	DocumentID string                 `json:"documentId" bson:"documentId"`
+	ID         string                 `json:"id,omitempty" bson:"_id,omitempty"`
+	Timestamp  time.Time              `json:"timestamp" bson:"timestamp"`
+}
+
+func (s HistoryEvent) GetCollectionName() string {
+	return "history"
+}
+
+func (s HistoryEvent) GetItemType() string {
+	return ""
+}
+
+// Actor sums up the changes recorded in the history as made by someone.
+type Actor struct {
+	Changes    int64     `json:"changes"`
+	LastChange time.Time `json:"lastChange"`
+	Name       string    `json:"name"`
+}
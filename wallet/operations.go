@@ -4,3 +4,33 @@
 package wallet
 
 type OperationsList []Tradable
+
+// ItemTypes lists the item types of operations.
+var ItemTypes = []string{
+	CertificateOfDepositItemType,
+	FICFIItemType,
+	FIIItemType,
+	StockFundItemType,
+	StockItemType,
+	TreasuryDirectItemType,
+}
+
+// NewOperation returns an empty operation of itemType, or nil when the item
+// type is unknown.
+func NewOperation(itemType string) Tradable {
+	switch itemType {
+	case StockItemType:
+		return &Stock{}
+	case FIIItemType:
+		return &FII{}
+	case CertificateOfDepositItemType:
+		return &CertificateOfDeposit{}
+	case TreasuryDirectItemType:
+		return &TreasuryDirect{}
+	case StockFundItemType:
+		return &StockFund{}
+	case FICFIItemType:
+		return &FICFI{}
+	}
+	return nil
+}
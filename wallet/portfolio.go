@@ -3,17 +3,14 @@
 
 package wallet
 
-import (
-	"math"
-)
-
 type Portfolio struct {
-	CostBasis     float64               `json:"costBasis" bson:"costBasis,omitempty"`
-	Gain          float64               `json:"gain" bson:"gain,omitempty"`
+	Aliases       []string              `json:"aliases,omitempty" bson:"aliases,omitempty"`
+	CostBasis     Money                 `json:"costBasis" bson:"costBasis,omitempty" swaggertype:"number"`
+	Gain          Money                 `json:"gain" bson:"gain,omitempty" swaggertype:"number"`
 	ID            string                `json:"id,omitempty" bson:"_id,omitempty"`
 	Items         map[string][]Position `json:"items" bson:"items,omitempty"`
 	Name          string                `json:"name" bson:"name" validate:"required"`
-	OverallReturn float64               `json:"overallReturn" bson:"overallReturn,omitempty"`
+	OverallReturn Money                 `json:"overallReturn" bson:"overallReturn,omitempty" swaggertype:"number"`
 	Slug          string                `json:"slug" bson:"slug" validate:"required"`
 }
 
@@ -25,8 +22,12 @@ func (s Portfolio) GetItemType() string {
 	return ""
 }
 
-func roundFloatTwoDecimalPlaces(n float64) float64 {
-	return math.Ceil(n*100) / 100
+func (s Portfolio) GetID() string {
+	return s.ID
+}
+
+func (s Portfolio) GetSlug() string {
+	return s.Slug
 }
 
 func (p *Portfolio) Recalculate() {
@@ -34,16 +35,18 @@ func (p *Portfolio) Recalculate() {
 		return
 	}
 
-	costBasis := 0.0
-	gain := 0.0
+	costBasis := Zero
+	gain := Zero
 	for _, items := range p.Items {
 		for _, item := range items {
-			costBasis += item.CostBasis
-			gain += item.Gain
+			costBasis = costBasis.Add(item.CostBasis.Decimal)
+			gain = gain.Add(item.Gain.Decimal)
 		}
 	}
 
-	p.CostBasis = roundFloatTwoDecimalPlaces(costBasis)
-	p.Gain = roundFloatTwoDecimalPlaces(gain)
-	p.OverallReturn = roundFloatTwoDecimalPlaces(p.Gain * 100 / p.CostBasis)
+	p.CostBasis = NewMoney(costBasis)
+	p.Gain = NewMoney(gain)
+	if !costBasis.IsZero() {
+		p.OverallReturn = NewMoney(gain.Mul(hundred).Div(costBasis))
+	}
 }
@@ -3,31 +3,37 @@
 
 package wallet
 
+import "time"
+
 type Position struct {
-	AveragePrice  float64        `json:"averagePrice" bson:"averagePrice"`
-	Change        float64        `json:"change" bson:"change"`
-	ClosingPrice  float64        `json:"closingPrice" bson:"closingPrice"`
-	Commission    float64        `json:"commission" bson:"commission"`
-	CostBasis     float64        `json:"costBasis" bson:"costBasis"`
-	Gain          float64        `json:"gain" bson:"gain"`
+	AveragePrice  Money          `json:"averagePrice" bson:"averagePrice" swaggertype:"number"`
+	Change        Decimal        `json:"change" bson:"change"`
+	ClosingPrice  Decimal        `json:"closingPrice" bson:"closingPrice"`
+	Commission    Money          `json:"commission" bson:"commission" swaggertype:"number"`
+	CostBasis     Money          `json:"costBasis" bson:"costBasis" swaggertype:"number"`
+	Gain          Money          `json:"gain" bson:"gain" swaggertype:"number"`
 	ItemType      string         `json:"itemType" bson:"itemType"`
-	LastPrice     float64        `json:"lastPrice" bson:"lastPrice"`
-	LastYearHigh  float64        `json:"lastYearHigh" bson:"lastYearHigh"`
-	LastYearLow   float64        `json:"lastYearLow" bson:"lastYearLow"`
+	LastPrice     Decimal        `json:"lastPrice" bson:"lastPrice"`
+	LastYearHigh  Decimal        `json:"lastYearHigh" bson:"lastYearHigh"`
+	LastYearLow   Decimal        `json:"lastYearLow" bson:"lastYearLow"`
 	Name          string         `json:"name" bson:"name"`
 	Operations    OperationsList `json:"operations" bson:"operations"`
-	OverallReturn float64        `json:"overallReturn" bson:"overallReturn"`
+	OverallReturn Money          `json:"overallReturn" bson:"overallReturn" swaggertype:"number"`
+	QuoteStale    bool           `json:"quoteStale" bson:"quoteStale"`
+	QuotedAt      *time.Time     `json:"quotedAt,omitempty" bson:"quotedAt,omitempty"`
 	Sector        string         `json:"sector" bson:"sector"`
 	Segment       string         `json:"segment" bson:"segment"`
-	Shares        float64        `json:"shares" bson:"shares"`
+	Shares        Decimal        `json:"shares" bson:"shares"`
 	SubSector     string         `json:"subSector" bson:"subSector"`
 	Symbol        string         `json:"symbol" bson:"symbol" validate:"required"`
 }
 
+var hundred = NewDecimalFromInt(100)
+
 func (pi *Position) Recalculate() {
-	commission := 0.0
-	totalPrice := 0.0
-	totalShares := 0.0
+	commission := Zero
+	totalPrice := Zero
+	totalShares := Zero
 
 	for _, s := range pi.Operations {
 		var operationPrice = s.GetPrice()
@@ -35,34 +41,47 @@ func (pi *Position) Recalculate() {
 		var operationCommission = s.GetComission()
 		var operationType = s.(Tradable).GetType()
 		if operationType == "purchase" {
-			totalPrice += (operationPrice * operationShares) + operationCommission
-			totalShares += operationShares
-			commission += operationCommission
+			totalPrice = totalPrice.Add(operationPrice.Mul(operationShares)).Add(operationCommission)
+			totalShares = totalShares.Add(operationShares)
+			commission = commission.Add(operationCommission)
 		} else {
 			// To properly calculate the average price we need to remove from
 			// the cost basis based on the average price at the time of the
 			// sale.
-			totalPrice -= (totalPrice / totalShares) * operationShares
-			totalPrice += operationCommission
-			totalShares -= operationShares
-			commission += operationCommission
+			if !totalShares.IsZero() {
+				totalPrice = totalPrice.Sub(totalPrice.Mul(operationShares).Div(totalShares))
+			}
+			totalPrice = totalPrice.Add(operationCommission)
+			totalShares = totalShares.Sub(operationShares)
+			commission = commission.Add(operationCommission)
 		}
 	}
 
 	pi.Shares = totalShares
-	if pi.Shares > 0 {
-		pi.Commission = roundFloatTwoDecimalPlaces(commission)
-		pi.CostBasis = roundFloatTwoDecimalPlaces(totalPrice)
-		pi.AveragePrice = roundFloatTwoDecimalPlaces(pi.CostBasis / pi.Shares)
+	if pi.Shares.Sign() > 0 {
+		pi.Commission = NewMoney(commission)
+		pi.CostBasis = NewMoney(totalPrice)
+		pi.AveragePrice = NewMoney(totalPrice.Div(pi.Shares))
+	}
+	pi.Revalue()
+}
 
-		// FIXME
-		if pi.ItemType == "stocks" || pi.ItemType == "fiis" {
-			gain := (pi.Shares * pi.LastPrice) - pi.CostBasis
-			pi.Gain = roundFloatTwoDecimalPlaces(gain)
-			pi.OverallReturn = roundFloatTwoDecimalPlaces((gain * 100) / pi.CostBasis)
-		} else {
-			pi.Gain = 0
-			pi.OverallReturn = 0
+// Revalue computes the gain and overall return of the position from its
+// shares, cost basis and last price, such as for a position whose totals
+// were materialized.
+func (pi *Position) Revalue() {
+	if pi.Shares.Sign() <= 0 {
+		return
+	}
+	// Without a quote the gain is unknown, not a loss of everything.
+	if (pi.ItemType == "stocks" || pi.ItemType == "fiis") && pi.QuotedAt != nil {
+		gain := pi.Shares.Mul(pi.LastPrice).Sub(pi.CostBasis.Decimal)
+		pi.Gain = NewMoney(gain)
+		if !pi.CostBasis.IsZero() {
+			pi.OverallReturn = NewMoney(gain.Mul(hundred).Div(pi.CostBasis.Decimal))
 		}
+	} else {
+		pi.Gain = Money{}
+		pi.OverallReturn = Money{}
 	}
 }
@@ -0,0 +1,24 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira (https://github.com/mfinancecombr)
+// Licensed under the BSD 3-Clause License
+
+package wallet
+
+import (
+	"time"
+)
+
+// Price is the closing price of a symbol on a day.
+type Price struct {
+	Date     time.Time `json:"date" bson:"date" validate:"required"`
+	ItemType string    `json:"itemType" bson:"itemType" validate:"required"`
+	Price    Decimal   `json:"price" bson:"price" validate:"required"`
+	Symbol   string    `json:"symbol" bson:"symbol" validate:"required"`
+}
+
+func (s Price) GetCollectionName() string {
+	return "prices"
+}
+
+func (s Price) GetItemType() string {
+	return s.ItemType
+}
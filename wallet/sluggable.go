@@ -0,0 +1,10 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira
+// Licensed under the BSD 3-Clause License
+
+package wallet
+
+type Sluggable interface {
+	Queryable
+	GetID() string
+	GetSlug() string
+}
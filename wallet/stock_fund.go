@@ -9,13 +9,13 @@ import (
 
 type StockFund struct {
 	BrokerSlug    string     `json:"brokerSlug" bson:"brokerSlug" validate:"required"`
-	Commission    float64    `json:"commission" bson:"commission"`
+	Commission    Decimal    `json:"commission" bson:"commission"`
 	Date          *time.Time `json:"date" bson:"date" validate:"required"`
 	ID            string     `json:"id,omitempty" bson:"_id,omitempty"`
 	ItemType      string     `json:"itemType" bson:"itemType" validate:"required"`
 	PortfolioSlug string     `json:"portfolioSlug" bson:"portfolioSlug" validate:"required"`
-	Price         float64    `json:"price" bson:"price" validate:"required"`
-	Shares        float64    `json:"shares" bson:"shares" validate:"required"`
+	Price         Decimal    `json:"price" bson:"price" validate:"required"`
+	Shares        Decimal    `json:"shares" bson:"shares" validate:"required"`
 	Symbol        string     `json:"symbol" bson:"symbol" validate:"required"`
 	Type          string     `json:"type" bson:"type" validate:"required"`
 }
@@ -28,15 +28,15 @@ func NewStockFund() *StockFund {
 	return &StockFund{ItemType: StockFundItemType}
 }
 
-func (s StockFund) GetPrice() float64 {
+func (s StockFund) GetPrice() Decimal {
 	return s.Price
 }
 
-func (s StockFund) GetShares() float64 {
+func (s StockFund) GetShares() Decimal {
 	return s.Shares
 }
 
-func (s StockFund) GetComission() float64 {
+func (s StockFund) GetComission() Decimal {
 	return s.Commission
 }
 
@@ -48,6 +48,17 @@ func (s StockFund) GetBrokerSlug() string {
 	return s.BrokerSlug
 }
 
+func (s StockFund) GetPortfolioSlug() string {
+	return s.PortfolioSlug
+}
+
+// SetReferences replaces the broker and portfolio slugs, such as an alias by
+// the current slug.
+func (s *StockFund) SetReferences(brokerSlug, portfolioSlug string) {
+	s.BrokerSlug = brokerSlug
+	s.PortfolioSlug = portfolioSlug
+}
+
 func (s StockFund) GetCollectionName() string {
 	return "operations"
 }
@@ -55,3 +66,7 @@ func (s StockFund) GetCollectionName() string {
 func (s StockFund) GetItemType() string {
 	return StockFundItemType
 }
+
+func (s StockFund) GetID() string {
+	return s.ID
+}
@@ -4,9 +4,11 @@
 package wallet
 
 type Tradable interface {
-	GetPrice() float64
-	GetShares() float64
-	GetComission() float64
+	GetPrice() Decimal
+	GetShares() Decimal
+	GetComission() Decimal
+	GetID() string
 	GetType() string
 	GetBrokerSlug() string
+	GetPortfolioSlug() string
 }
@@ -0,0 +1,31 @@
+// Copyright (c) 2020, Marcelo Jorge Vieira
+// Licensed under the BSD 3-Clause License
+
+package wallet
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TrashedDocument is a deleted broker, portfolio or operation, serialized as
+// the document itself with its deletedAt time.
+type TrashedDocument struct {
+	DeletedAt time.Time
+	Document  Queryable
+}
+
+func (t TrashedDocument) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(t.Document)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if fields["deletedAt"], err = json.Marshal(t.DeletedAt); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
@@ -9,36 +9,36 @@ import (
 
 type TreasuryDirect struct {
 	BrokerSlug string     `json:"brokerSlug" bson:"brokerSlug" validate:"required"`
-	Commission float64    `json:"commission" bson:"commission"`
+	Commission Decimal    `json:"commission" bson:"commission"`
 	Date       *time.Time `json:"date" bson:"date" validate:"required"`
 	//DueDate           *time.Time `json:"dueDate" bson:"dueDate" validate:"required"`
 	FixedInterestRate float64 `json:"fixedInterestRate" bson:"fixedInterestRate" validate:"required"`
 	ID                string  `json:"id,omitempty" bson:"_id,omitempty"`
 	ItemType          string  `json:"itemType" bson:"itemType" validate:"required"`
 	PortfolioSlug     string  `json:"portfolioSlug" bson:"portfolioSlug" validate:"required"`
-	Price             float64 `json:"price" bson:"price" validate:"required"`
-	Shares            float64 `json:"shares" bson:"shares" validate:"required"`
+	Price             Decimal `json:"price" bson:"price" validate:"required"`
+	Shares            Decimal `json:"shares" bson:"shares" validate:"required"`
 	Symbol            string  `json:"symbol" bson:"symbol" validate:"required"`
 	Type              string  `json:"type" bson:"type" validate:"required"`
 }
 
 type TreasuryDirectList []TreasuryDirect
 
-const TreasuryDirectItemType = "treasury-direct"
+const TreasuryDirectItemType = "treasuries-direct"
 
 func NewTreasuryDirect() *TreasuryDirect {
 	return &TreasuryDirect{ItemType: TreasuryDirectItemType}
 }
 
-func (s TreasuryDirect) GetPrice() float64 {
+func (s TreasuryDirect) GetPrice() Decimal {
 	return s.Price
 }
 
-func (s TreasuryDirect) GetShares() float64 {
+func (s TreasuryDirect) GetShares() Decimal {
 	return s.Shares
 }
 
-func (s TreasuryDirect) GetComission() float64 {
+func (s TreasuryDirect) GetComission() Decimal {
 	return s.Commission
 }
 
@@ -50,6 +50,17 @@ func (s TreasuryDirect) GetBrokerSlug() string {
 	return s.BrokerSlug
 }
 
+func (s TreasuryDirect) GetPortfolioSlug() string {
+	return s.PortfolioSlug
+}
+
+// SetReferences replaces the broker and portfolio slugs, such as an alias by
+// the current slug.
+func (s *TreasuryDirect) SetReferences(brokerSlug, portfolioSlug string) {
+	s.BrokerSlug = brokerSlug
+	s.PortfolioSlug = portfolioSlug
+}
+
 func (s TreasuryDirect) GetCollectionName() string {
 	return "operations"
 }
@@ -57,3 +68,7 @@ func (s TreasuryDirect) GetCollectionName() string {
 func (s TreasuryDirect) GetItemType() string {
 	return TreasuryDirectItemType
 }
+
+func (s TreasuryDirect) GetID() string {
+	return s.ID
+}